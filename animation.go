@@ -6,6 +6,8 @@ package animation
 
 import (
 	"image/color"
+	"math"
+	"math/rand"
 	"time"
 )
 
@@ -23,3 +25,89 @@ type Animation interface {
 	// Returns true if the current animation completed a cycle; false otherwise
 	Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool)
 }
+
+// Cloner is implemented by effects which can create a fresh, unstarted copy of
+// themselves, so that a sequence step can have a new instance each time it
+// runs rather than sharing one
+type Cloner interface {
+	Clone() Animation
+}
+
+// cloneEffect clones an effect if it's a Cloner, or otherwise returns it
+// as-is, to be shared
+func cloneEffect(effect Animation) Animation {
+	if cloner, ok := effect.(Cloner); ok {
+		return cloner.Clone()
+	}
+	return effect
+}
+
+// forkRand creates a source of randomness for a clone, seeded from the
+// original's source. Clones draw from sources of their own, so don't interfere
+// with each other, but are still reproducible given the original's seed
+func forkRand(rng *rand.Rand) *rand.Rand {
+	return rand.New(rand.NewSource(rng.Int63()))
+}
+
+// Forever is the duration of an effect that never completes
+const Forever = time.Duration(math.MaxInt64)
+
+// Finite is implemented by effects which know how long they run for before
+// completing. Effects that never complete report Forever
+type Finite interface {
+	Animation
+	Duration() time.Duration
+}
+
+// DurationOf works out how long an effect runs for, looking through any
+// combinators and views wrapped around it. known is false if that can't be
+// determined - if the effect runs until some condition is met, for example
+func DurationOf(effect Animation) (d time.Duration, known bool) {
+	switch e := effect.(type) {
+	case Finite:
+		return e.Duration(), true
+	case *Loop:
+		return Forever, true
+	case *Repeat:
+		if e.count < 1 {
+			return 0, true
+		}
+		if d, known = DurationOf(e.effect); known && d != Forever {
+			d *= time.Duration(e.count)
+		}
+		return d, known
+	case *Reverse:
+		return e.duration, true
+	case *PingPong:
+		return 2 * e.duration, true
+	case *ClipTo:
+		if d, known = DurationOf(e.effect); known && d < e.duration {
+			return d, true
+		}
+		return e.duration, true
+	case *Speed:
+		if d, known = DurationOf(e.effect); known && d != Forever {
+			if e.factor <= 0 {
+				return Forever, true
+			}
+			d = scaleDuration(d, 1.0/e.factor)
+		}
+		return d, known
+	case *Delay:
+		if d, known = DurationOf(e.effect); known && d != Forever {
+			d += e.delay
+		}
+		return d, known
+	case *Crossfade:
+		return DurationOf(e.to)
+	case *Eased:
+		return DurationOf(e.effect)
+	case *SubRange:
+		return DurationOf(e.effect)
+	case *Mirror:
+		return DurationOf(e.effect)
+	case *Tile:
+		return DurationOf(e.effect)
+	}
+	return 0, false
+}
@@ -0,0 +1,403 @@
+package animation
+
+/*
+Audio analysis, for effects that react to music. PCM audio is read from an
+io.Reader - a WAV file, or raw samples on stdin - at the rate frames are
+rendered, and analyzed for overall level (RMS), energy in frequency bands, and
+beats. No sound hardware is involved, so recorded audio can be used in tests.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of samples analyzed at once. Must be a power of two, for the FFT
+	audioWindowSize = 1024
+	// Number of frequency bands reported
+	audioBands = 8
+	// Lowest frequency considered, in Hz
+	audioMinFrequency = 40.0
+	// How far back beat detection looks to establish the average energy
+	audioBeatHistory = time.Second
+	// A window is a beat if its energy exceeds the recent average by this factor
+	audioBeatSensitivity = 1.5
+	// Minimum time between beats
+	audioMinBeatInterval = 200 * time.Millisecond
+	// Windows quieter than this RMS level are never beats
+	audioBeatFloor = 0.01
+)
+
+// PCMFormat describes the layout of PCM audio samples. Samples are little
+// endian, signed for 16 bits and unsigned for 8 bits, with channels interleaved
+type PCMFormat struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int // 8 or 16
+}
+
+// ReadWAVHeader reads the header of a WAV file, leaving r positioned at the
+// start of the sample data
+func ReadWAVHeader(r io.Reader) (PCMFormat, error) {
+	var format PCMFormat
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return format, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return format, errors.New("not a WAV file")
+	}
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return format, fmt.Errorf("reading WAV chunk header: %v", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return format, fmt.Errorf("reading WAV format: %v", err)
+			}
+			if size < 16 {
+				return format, errors.New("WAV format chunk too short")
+			}
+			if encoding := binary.LittleEndian.Uint16(fmtChunk[0:2]); encoding != 1 {
+				return format, fmt.Errorf("unsupported WAV encoding %d; only PCM is supported", encoding)
+			}
+			format.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			format.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			format.BitsPerSample = int(binary.LittleEndian.Uint16(fmtChunk[14:16]))
+			if format.BitsPerSample != 8 && format.BitsPerSample != 16 {
+				return format, fmt.Errorf("unsupported WAV sample size %d bits", format.BitsPerSample)
+			}
+			if format.Channels == 0 || format.SampleRate == 0 {
+				return format, errors.New("WAV format has no channels or a zero sample rate")
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return format, errors.New("WAV data precedes format")
+			}
+			return format, nil
+		default:
+			// Skip chunks we don't care about, which are padded to an even size
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return format, fmt.Errorf("skipping WAV chunk %q: %v", id, err)
+			}
+		}
+		if id == "fmt " && size%2 == 1 {
+			io.CopyN(ioutil.Discard, r, 1)
+		}
+	}
+}
+
+// AudioLevels is a snapshot of the analysis of the most recent window of audio
+type AudioLevels struct {
+	RMS   float64   // Overall level, 0.0-1.0
+	Bands []float64 // Energy in each frequency band, lowest first, roughly 0.0-1.0
+	Beats int       // Number of beats detected so far. Compare with an earlier value to spot new beats
+}
+
+// AudioAnalyzer reads PCM audio and analyzes it as it's played. It's driven
+// by frame times, so can be shared between effects rendering the same frames
+type AudioAnalyzer struct {
+	r         io.Reader
+	format    PCMFormat
+	raw       []byte
+	window    []float64 // Samples accumulating for the next analysis
+	consumed  int64     // Samples (per channel) read so far
+	startTime time.Time
+	started   bool
+	eof       bool
+	history   []float64 // Recent window energies, for beat detection
+	lastBeat  time.Duration
+	levels    AudioLevels
+	sync.Mutex
+}
+
+// NewAudioAnalyzer creates an AudioAnalyzer reading raw PCM samples of the
+// specified format from r. Reads are buffered, as samples are read one at a
+// time while rendering frames
+func NewAudioAnalyzer(r io.Reader, format PCMFormat) *AudioAnalyzer {
+	return &AudioAnalyzer{
+		r:        bufio.NewReader(r),
+		format:   format,
+		window:   make([]float64, 0, audioWindowSize),
+		lastBeat: -audioMinBeatInterval,
+		levels:   AudioLevels{Bands: make([]float64, audioBands)},
+	}
+}
+
+// NewWAVAnalyzer creates an AudioAnalyzer reading a WAV file from r
+func NewWAVAnalyzer(r io.Reader) (*AudioAnalyzer, error) {
+	format, err := ReadWAVHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewAudioAnalyzer(r, format), nil
+}
+
+// Update reads and analyzes audio up to the point corresponding to now, with
+// the first call marking the start of the audio. It returns the latest levels.
+// Reads from r may block if the audio isn't yet available
+func (a *AudioAnalyzer) Update(now time.Time) AudioLevels {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.started {
+		a.startTime = now
+		a.started = true
+	}
+	target := int64(now.Sub(a.startTime).Seconds() * float64(a.format.SampleRate))
+	for a.consumed < target && !a.eof {
+		sample, err := a.readSample()
+		if err != nil {
+			a.eof = true
+			// Silence from here on
+			a.levels = AudioLevels{Bands: make([]float64, audioBands), Beats: a.levels.Beats}
+			break
+		}
+		a.consumed++
+		a.window = append(a.window, sample)
+		if len(a.window) == audioWindowSize {
+			a.analyze()
+			a.window = a.window[:0]
+		}
+	}
+	return a.snapshot()
+}
+
+// Levels returns the latest levels without reading any more audio
+func (a *AudioAnalyzer) Levels() AudioLevels {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.snapshot()
+}
+
+func (a *AudioAnalyzer) snapshot() AudioLevels {
+	levels := a.levels
+	levels.Bands = append([]float64(nil), a.levels.Bands...)
+	return levels
+}
+
+// readSample reads a sample for each channel, returning their average in the
+// range -1.0 to 1.0
+func (a *AudioAnalyzer) readSample() (float64, error) {
+	bytesPerSample := a.format.BitsPerSample / 8
+	channels := a.format.Channels
+	if channels < 1 {
+		channels = 1
+	}
+	size := bytesPerSample * channels
+	if cap(a.raw) < size {
+		a.raw = make([]byte, size)
+	}
+	a.raw = a.raw[:size]
+	if _, err := io.ReadFull(a.r, a.raw); err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for ch := 0; ch < channels; ch++ {
+		if bytesPerSample == 1 {
+			total += (float64(a.raw[ch]) - 128.0) / 128.0
+		} else {
+			total += float64(int16(binary.LittleEndian.Uint16(a.raw[ch*2:]))) / 32768.0
+		}
+	}
+	return total / float64(channels), nil
+}
+
+// analyze computes levels for a complete window of samples
+func (a *AudioAnalyzer) analyze() {
+	n := len(a.window)
+	sumSquares := 0.0
+	spectrum := make([]complex128, n)
+	for idx, s := range a.window {
+		sumSquares += s * s
+		// Apply a Hann window to reduce spectral leakage
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(idx)/float64(n-1))
+		spectrum[idx] = complex(s*hann, 0)
+	}
+	rms := math.Sqrt(sumSquares / float64(n))
+	fft(spectrum)
+
+	// Split the spectrum into logarithmically-spaced bands up to Nyquist
+	nyquist := float64(a.format.SampleRate) / 2.0
+	binWidth := float64(a.format.SampleRate) / float64(n)
+	bands := make([]float64, audioBands)
+	ratio := math.Pow(nyquist/audioMinFrequency, 1.0/audioBands)
+	low := audioMinFrequency
+	for b := range bands {
+		high := low * ratio
+		first, last := int(low/binWidth), int(high/binWidth)
+		if last <= first {
+			last = first + 1
+		}
+		total, count := 0.0, 0
+		for bin := first; bin < last && bin < n/2; bin++ {
+			total += cmplx.Abs(spectrum[bin])
+			count++
+		}
+		if count > 0 {
+			// A full-scale sine with a Hann window peaks at n/4
+			bands[b] = total / float64(count) / (float64(n) / 4.0)
+		}
+		low = high
+	}
+
+	// Beat detection: compare this window's energy with the recent average
+	windowDuration := time.Duration(float64(n) / float64(a.format.SampleRate) * float64(time.Second))
+	now := time.Duration(float64(a.consumed) / float64(a.format.SampleRate) * float64(time.Second))
+	energy := rms * rms
+	average := 0.0
+	for _, e := range a.history {
+		average += e / float64(len(a.history))
+	}
+	if rms > audioBeatFloor && energy > audioBeatSensitivity*average &&
+		now-a.lastBeat >= audioMinBeatInterval {
+		a.levels.Beats++
+		a.lastBeat = now
+	}
+	maxHistory := int(audioBeatHistory / windowDuration)
+	if maxHistory < 1 {
+		maxHistory = 1
+	}
+	a.history = append(a.history, energy)
+	if len(a.history) > maxHistory {
+		a.history = a.history[len(a.history)-maxHistory:]
+	}
+
+	a.levels.RMS = rms
+	a.levels.Bands = bands
+}
+
+// fft performs an in-place radix-2 fast Fourier transform. len(x) must be a
+// power of two
+func fft(x []complex128) {
+	n := len(x)
+	// Bit-reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
+
+// VUMeter is a Meter driven by an audio level: either overall RMS, or the
+// energy in a single frequency band
+type VUMeter struct {
+	analyzer *AudioAnalyzer
+	band     int
+	gain     float64
+	meter    *Meter
+}
+
+// NewVUMeter creates a VUMeter. band selects a frequency band to display, or
+// -1 for the overall level. gain scales the level before display, with 1.0
+// showing a full-scale signal as 100%
+func NewVUMeter(analyzer *AudioAnalyzer, band int, gain float64, fill, empty color.RGBA) *VUMeter {
+	return &VUMeter{
+		analyzer: analyzer,
+		band:     band,
+		gain:     gain,
+		meter:    NewMeter(fill, empty, 50*time.Millisecond),
+	}
+}
+
+// Start starts the VUMeter
+func (effect *VUMeter) Start(startTime time.Time) {
+	effect.meter.Start(startTime)
+}
+
+// Clone creates an unstarted copy of the effect, sharing its analyzer
+func (effect *VUMeter) Clone() Animation {
+	c := *effect
+	c.meter = effect.meter.Clone().(*Meter)
+	return &c
+}
+
+// Frame creates a frame of the VUMeter effect. It never completes
+func (effect *VUMeter) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	levels := effect.analyzer.Update(frameTime)
+	level := levels.RMS
+	if effect.band >= 0 && effect.band < len(levels.Bands) {
+		level = levels.Bands[effect.band]
+	}
+	effect.meter.SetValue(level * effect.gain * 100.0)
+	return effect.meter.Frame(buf, frameTime)
+}
+
+// BeatFlash flashes a color each time a beat is detected in the audio
+type BeatFlash struct {
+	analyzer *AudioAnalyzer
+	flash    *Flash
+	beats    int
+	flashing bool
+}
+
+// NewBeatFlash creates a BeatFlash effect, with each flash decaying over decay
+func NewBeatFlash(analyzer *AudioAnalyzer, c color.RGBA, decay time.Duration) *BeatFlash {
+	return &BeatFlash{analyzer: analyzer, flash: NewFlash(c, decay)}
+}
+
+// Start starts the BeatFlash effect. Only beats from here on cause flashes
+func (effect *BeatFlash) Start(startTime time.Time) {
+	effect.beats = effect.analyzer.Update(startTime).Beats
+	effect.flashing = false
+}
+
+// Clone creates an unstarted copy of the effect, sharing its analyzer
+func (effect *BeatFlash) Clone() Animation {
+	return &BeatFlash{analyzer: effect.analyzer, flash: effect.flash.Clone().(*Flash)}
+}
+
+// Frame creates a frame of the BeatFlash effect. It never completes
+func (effect *BeatFlash) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if beats := effect.analyzer.Update(frameTime).Beats; beats != effect.beats {
+		effect.beats = beats
+		effect.flash.Start(frameTime)
+		effect.flashing = true
+	}
+	if effect.flashing {
+		var done bool
+		if buf, done = effect.flash.Frame(buf, frameTime); !done {
+			return buf, false
+		}
+		effect.flashing = false
+	}
+	for idx := range buf {
+		buf[idx] = color.RGBA{0, 0, 0, 0xff}
+	}
+	return buf, false
+}
@@ -0,0 +1,125 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"math"
+	"testing"
+	"time"
+)
+
+const testSampleRate = 8000
+
+// makeWAV creates a mono 16-bit WAV file containing a 1kHz tone at half of
+// full scale for the first 300ms of every second, and silence otherwise
+func makeWAV(seconds int) []byte {
+	samples := make([]int16, seconds*testSampleRate)
+	for idx := range samples {
+		if idx%testSampleRate < testSampleRate*3/10 {
+			samples[idx] = int16(0.5 * 32767 * math.Sin(2*math.Pi*1000*float64(idx)/testSampleRate))
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+len(samples)*2))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16),                 // Format chunk size
+		uint16(1),                  // PCM
+		uint16(1),                  // Mono
+		uint32(testSampleRate),     // Sample rate
+		uint32(testSampleRate * 2), // Bytes per second
+		uint16(2),                  // Bytes per sample
+		uint16(16),                 // Bits per sample
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(samples)*2))
+	binary.Write(&b, binary.LittleEndian, samples)
+	return b.Bytes()
+}
+
+func TestWAVHeader(t *testing.T) {
+	format, err := ReadWAVHeader(bytes.NewReader(makeWAV(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != (PCMFormat{SampleRate: testSampleRate, Channels: 1, BitsPerSample: 16}) {
+		t.Fatalf("Unexpected format %+v", format)
+	}
+	if _, err := ReadWAVHeader(bytes.NewReader([]byte("not a wav file"))); err == nil {
+		t.Fatal("No error for invalid WAV")
+	}
+	noChannels := makeWAV(1)
+	binary.LittleEndian.PutUint16(noChannels[22:], 0)
+	noRate := makeWAV(1)
+	binary.LittleEndian.PutUint32(noRate[24:], 0)
+	for _, wav := range [][]byte{noChannels, noRate} {
+		if _, err := ReadWAVHeader(bytes.NewReader(wav)); err == nil {
+			t.Fatal("No error for WAV with no channels or zero sample rate")
+		}
+	}
+}
+
+func TestAudioAnalysis(t *testing.T) {
+	a, err := NewWAVAnalyzer(bytes.NewReader(makeWAV(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	a.Update(now)
+
+	// Partway through the first tone
+	levels := a.Update(now.Add(260 * time.Millisecond))
+	if math.Abs(levels.RMS-0.5/math.Sqrt2) > 0.01 {
+		t.Fatalf("Unexpected RMS for tone: %v", levels.RMS)
+	}
+	loudest := 0
+	for b := range levels.Bands {
+		if levels.Bands[b] > levels.Bands[loudest] {
+			loudest = b
+		}
+	}
+	if loudest != 5 {
+		t.Fatalf("1kHz tone loudest in band %d: %v", loudest, levels.Bands)
+	}
+
+	// During silence
+	if levels = a.Update(now.Add(800 * time.Millisecond)); levels.RMS != 0 {
+		t.Fatalf("Unexpected RMS for silence: %v", levels.RMS)
+	}
+
+	// Once through the whole file, each tone should have been a beat
+	if levels = a.Update(now.Add(4 * time.Second)); levels.Beats != 3 {
+		t.Fatalf("Detected %d beats, expected 3", levels.Beats)
+	}
+}
+
+func TestBeatFlash(t *testing.T) {
+	a, err := NewWAVAnalyzer(bytes.NewReader(makeWAV(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	effect := NewBeatFlash(a, white, 100*time.Millisecond)
+	vu := NewVUMeter(a, -1, 2.0, white, black)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	vu.Start(now)
+	buf := make([]color.RGBA, 10)
+	flashes := 0
+	lit := false
+	for tick := 0; tick < 100; tick++ {
+		frameTime := now.Add(time.Duration(tick) * 20 * time.Millisecond)
+		out, _ := effect.Frame(buf, frameTime)
+		if out[0] == white && !lit {
+			flashes++
+		}
+		lit = out[0] == white
+		vu.Frame(make([]color.RGBA, 10), frameTime)
+	}
+	if flashes != 2 {
+		t.Fatalf("%d flashes, expected 2", flashes)
+	}
+}
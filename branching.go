@@ -0,0 +1,164 @@
+package animation
+
+// Branching in sequences: operations which only apply under some condition,
+// choose at random between steps, or apply a limited number of times
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+// Vars holds the variables conditions are evaluated against, e.g. the portal's
+// level or faction
+type Vars map[string]interface{}
+
+// Condition decides whether an operation applies, given the current variables
+type Condition func(vars Vars) bool
+
+// IfEquals creates a Condition checking that a variable has the given value.
+// Numbers are compared by value, whatever their type
+func IfEquals(name string, value interface{}) Condition {
+	return func(vars Vars) bool {
+		if a, ok := numeric(vars[name]); ok {
+			b, ok := numeric(value)
+			return ok && a == b
+		}
+		return vars[name] == value
+	}
+}
+
+// IfAtLeast creates a Condition checking that a numeric variable is at least
+// threshold. Missing and non-numeric variables fail the check
+func IfAtLeast(name string, threshold float64) Condition {
+	return func(vars Vars) bool {
+		v, ok := numeric(vars[name])
+		return ok && v >= threshold
+	}
+}
+
+// IfBelow creates a Condition checking that a numeric variable is less than
+// threshold. Missing and non-numeric variables fail the check
+func IfBelow(name string, threshold float64) Condition {
+	return func(vars Vars) bool {
+		v, ok := numeric(vars[name])
+		return ok && v < threshold
+	}
+}
+
+// numeric gets a value of any integer or floating point type as a float64
+func numeric(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// Choice is one of the steps an operation may choose between at random
+type Choice struct {
+	StepName string
+	Weight   float64 // Relative likelihood of the step being chosen
+}
+
+// stepNames lists all the steps an operation might start
+func (op *Operation) stepNames() []string {
+	var names []string
+	if len(op.Choices) > 0 {
+		for _, c := range op.Choices {
+			names = append(names, c.StepName)
+		}
+	} else {
+		names = append(names, op.StepName)
+	}
+	if op.Otherwise != "" {
+		names = append(names, op.Otherwise)
+	}
+	return names
+}
+
+// choose picks one of the choices at random, in proportion to their weights
+func choose(choices []Choice, rng *rand.Rand) string {
+	total := 0.0
+	for _, c := range choices {
+		if c.Weight > 0 {
+			total += c.Weight
+		}
+	}
+	if total == 0 {
+		return choices[0].StepName
+	}
+	r := rng.Float64() * total
+	for _, c := range choices {
+		if c.Weight <= 0 {
+			continue
+		}
+		if r < c.Weight {
+			return c.StepName
+		}
+		r -= c.Weight
+	}
+	return choices[len(choices)-1].StepName
+}
+
+// mostLikely gives the choice with the highest weight (the first, if several
+// are equal)
+func mostLikely(choices []Choice) string {
+	best := choices[0]
+	for _, c := range choices[1:] {
+		if c.Weight > best.Weight {
+			best = c
+		}
+	}
+	return best.StepName
+}
+
+// resolve works out which step an operation starts, if any, counting it
+// towards its limit
+func (sr *SequenceRunner) resolve(op *Operation) (name string, ok bool) {
+	if op.Condition != nil && !op.Condition(sr.vars) {
+		return op.Otherwise, op.Otherwise != ""
+	}
+	if op.Limit > 0 {
+		if sr.opCounts[op] >= op.Limit {
+			sr.opCounts[op] = 0
+			return op.Otherwise, op.Otherwise != ""
+		}
+		sr.opCounts[op]++
+	}
+	if len(op.Choices) > 0 {
+		return choose(op.Choices, sr.rng), true
+	}
+	return op.StepName, true
+}
+
+// SetVar sets a variable for conditions to check
+func (sr *SequenceRunner) SetVar(name string, value interface{}) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	sr.vars[name] = value
+}
+
+// Var gets the value of a variable, or nil if it's not set
+func (sr *SequenceRunner) Var(name string) interface{} {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.vars[name]
+}
+
+// Seed reseeds the random choices made by operations. Each sequence started
+// by InitSequence takes a seed of its own from this, so is reproducible when
+// seeking. Runners start with the same fixed seed, so make the same choices
+// unless seeded differently
+func (sr *SequenceRunner) Seed(seed int64) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	sr.seeds.Seed(seed)
+}
@@ -0,0 +1,268 @@
+package animation
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditions(t *testing.T) {
+	vars := Vars{"level": float32(5), "faction": "ENL", "count": 3}
+	for _, c := range []struct {
+		name     string
+		cond     Condition
+		expected bool
+	}{
+		{"equals string", IfEquals("faction", "ENL"), true},
+		{"equals other string", IfEquals("faction", "RES"), false},
+		{"equals number of other type", IfEquals("count", 3.0), true},
+		{"at least", IfAtLeast("level", 5), true},
+		{"not at least", IfAtLeast("level", 5.5), false},
+		{"below", IfBelow("count", 4), true},
+		{"missing", IfAtLeast("health", 0), false},
+		{"not numeric", IfBelow("faction", 10), false},
+	} {
+		if c.cond(vars) != c.expected {
+			t.Fatalf("%s: expected %v", c.name, c.expected)
+		}
+	}
+}
+
+// runCounting runs a sequence from start for a while, counting the starts of
+// each step
+func runCounting(sr *SequenceRunner, seq *Sequence, start time.Time, d time.Duration) map[string]int {
+	sub := sr.Subscribe(1000)
+	defer sr.Unsubscribe(sub)
+	sr.InitSequence(seq, start)
+	for elapsed := time.Duration(0); elapsed <= d; elapsed += 10 * time.Millisecond {
+		sr.ProcessFrame(start.Add(elapsed))
+	}
+	counts := make(map[string]int)
+	for len(sub.Events) > 0 {
+		if ev := <-sub.Events; ev.Type == StepStarted {
+			counts[ev.Step]++
+		}
+	}
+	return counts
+}
+
+func TestConditionalOperation(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddStep("enl", &Step{Effect: NewTimedSolid(white, 50*ms)}).
+		AddStep("other", &Step{Effect: NewTimedSolid(black, 50*ms)}).
+		AddInitialOperation(Operation{StepName: "enl", Condition: IfEquals("faction", "ENL"), Otherwise: "other"})
+
+	sr := NewSequenceRunner([]uint{1})
+	if counts := runCounting(sr, seq, time.Unix(0, 0), 100*ms); counts["enl"] != 0 || counts["other"] != 1 {
+		t.Fatalf("Expected other step with faction unset; got %v", counts)
+	}
+	sr.SetVar("faction", "ENL")
+	if counts := runCounting(sr, seq, time.Unix(1, 0), 100*ms); counts["enl"] != 1 || counts["other"] != 0 {
+		t.Fatalf("Expected enl step with faction set; got %v", counts)
+	}
+}
+
+func TestLimitedLoop(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("loop", &Step{Effect: NewTimedSolid(white, 20*ms)}).
+		AddStep("after", &Step{Effect: NewTimedSolid(black, 20*ms)})
+	seq.steps["loop"].Next = []Operation{{StepName: "loop", Limit: 2, Otherwise: "after"}}
+	if err := seq.Validate([]uint{1}); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	sr := NewSequenceRunner([]uint{1})
+	for run := 0; run < 2; run++ {
+		// The counter starts afresh each run
+		if counts := runCounting(sr, seq, time.Unix(int64(run), 0), 500*ms); counts["loop"] != 3 || counts["after"] != 1 {
+			t.Fatalf("Run %d: expected loop three times then after; got %v", run, counts)
+		}
+	}
+	var timeline []string
+	for _, e := range seq.Timeline(time.Second) {
+		timeline = append(timeline, e.Step)
+	}
+	if strings.Join(timeline, ",") != "loop,loop,loop,after" {
+		t.Fatalf("Unexpected timeline %v", timeline)
+	}
+}
+
+func TestLimitedLoopInCycle(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("loop", &Step{Effect: NewTimedSolid(white, 20*ms)}).
+		AddStep("after", &Step{Effect: NewTimedSolid(black, 20*ms)})
+	seq.steps["loop"].Next = []Operation{{StepName: "loop", Limit: 2, Otherwise: "after"}}
+	seq.steps["after"].ThenDoImmediately("loop")
+
+	// The loop goes round three times on every pass of the outer cycle
+	const expected = "loop,loop,loop,after,loop,loop,loop,after,loop,loop,loop,after"
+	sr := NewSequenceRunner([]uint{1})
+	sub := sr.Subscribe(1000)
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	for elapsed := time.Duration(0); elapsed <= 500*ms; elapsed += 10 * ms {
+		sr.ProcessFrame(start.Add(elapsed))
+	}
+	var started []string
+	for len(sub.Events) > 0 {
+		if ev := <-sub.Events; ev.Type == StepStarted {
+			started = append(started, ev.Step)
+		}
+	}
+	if got := strings.Join(started, ","); !strings.HasPrefix(got, expected) {
+		t.Fatalf("Expected steps %s...; got %s", expected, got)
+	}
+
+	var timeline []string
+	for _, e := range seq.Timeline(240 * ms) {
+		timeline = append(timeline, e.Step)
+	}
+	if got := strings.Join(timeline, ","); !strings.HasPrefix(got, expected) {
+		t.Fatalf("Expected timeline %s...; got %s", expected, got)
+	}
+}
+
+func TestRandomChoice(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("pick", &Step{Effect: NewTimedSolid(white, 10*ms)}).
+		AddStep("common", &Step{UniverseID: 1, Effect: NewTimedSolid(white, 0)}).
+		AddStep("rare", &Step{UniverseID: 1, Effect: NewTimedSolid(white, 0)}).
+		AddStep("never", &Step{UniverseID: 1, Effect: NewTimedSolid(white, 0)})
+	seq.steps["pick"].Next = []Operation{
+		{StepName: "pick", Limit: 199},
+		{Choices: []Choice{{"common", 3}, {"rare", 1}, {"never", 0}}},
+	}
+
+	run := func(seed int64) map[string]int {
+		sr := NewSequenceRunner([]uint{1, 1})
+		sr.Seed(seed)
+		return runCounting(sr, seq, time.Unix(0, 0), 10*time.Second)
+	}
+	counts := run(42)
+	if total := counts["common"] + counts["rare"]; total != 200 || counts["never"] != 0 {
+		t.Fatalf("Expected 200 choices, none of never; got %v", counts)
+	}
+	if counts["common"] < 125 || counts["common"] > 175 {
+		t.Fatalf("Expected choices weighted 3:1; got %v", counts)
+	}
+	again := run(42)
+	if again["common"] != counts["common"] {
+		t.Fatalf("Expected the same choices with the same seed; got %v then %v", counts, again)
+	}
+	unseeded := func() map[string]int {
+		return runCounting(NewSequenceRunner([]uint{1, 1}), seq, time.Unix(0, 0), 10*time.Second)
+	}
+	if first, second := unseeded(), unseeded(); first["common"] != second["common"] {
+		t.Fatalf("Expected the same choices from unseeded runners; got %v then %v", first, second)
+	}
+}
+
+func TestReproducibleChoices(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence()
+	// Several universes complete steps, and make choices, in the same frame
+	for u := uint(0); u < 4; u++ {
+		name := fmt.Sprintf("pick%d", u)
+		seq.AddInitialStep(name, &Step{UniverseID: u, Effect: NewTimedSolid(white, 10*ms)})
+		seq.steps[name].Next = []Operation{
+			{StepName: name, Limit: 20},
+			{Choices: []Choice{{"heads", 1}, {"tails", 1}}},
+		}
+	}
+	seq.AddStep("heads", &Step{UniverseID: 4, Effect: NewTimedSolid(white, 0)}).
+		AddStep("tails", &Step{UniverseID: 4, Effect: NewTimedSolid(black, 0)})
+
+	run := func() string {
+		sr := NewSequenceRunner([]uint{1, 1, 1, 1, 1})
+		sr.Seed(7)
+		sub := sr.Subscribe(1000)
+		start := time.Unix(0, 0)
+		sr.InitSequence(seq, start)
+		for elapsed := time.Duration(0); elapsed <= time.Second; elapsed += 10 * ms {
+			sr.ProcessFrame(start.Add(elapsed))
+		}
+		var started []string
+		for len(sub.Events) > 0 {
+			if ev := <-sub.Events; ev.Type == StepStarted {
+				started = append(started, ev.Step)
+			}
+		}
+		return strings.Join(started, ",")
+	}
+	first := run()
+	for attempt := 0; attempt < 20; attempt++ {
+		if again := run(); again != first {
+			t.Fatalf("Expected the same steps with the same seed; got %s then %s", first, again)
+		}
+	}
+}
+
+func TestBranchingDOT(t *testing.T) {
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Effect: NewSolid(white)}).
+		AddStep("b", &Step{Effect: NewSolid(white)}).
+		AddStep("c", &Step{Effect: NewSolid(white)})
+	seq.steps["a"].Next = []Operation{
+		{Choices: []Choice{{"b", 2}, {"c", 1}}, Condition: IfAtLeast("level", 3), Otherwise: "a"},
+	}
+	var buf bytes.Buffer
+	if err := seq.WriteDOT(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`"a" -> "b" [label="if, weight 2"];`,
+		`"a" -> "c" [label="if, weight 1"];`,
+		`"a" -> "a" [style=dotted, label="otherwise"];`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("Expected DOT output to contain %s; got\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestParseBranching(t *testing.T) {
+	def := `{
+	  "steps": [
+	    {"name": "idle", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#ffffff"},
+	     "next": [
+	       {"choices": [{"step": "idle", "weight": 3}, {"step": "sparkle"}], "limit": 5, "otherwise": "sweep"},
+	       {"step": "green", "if": {"var": "faction", "equals": "ENL"}}
+	     ]},
+	    {"name": "sparkle", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#ffffff"}},
+	    {"name": "sweep", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#ffffff"}},
+	    {"name": "green", "universe": "towerLevel1Window2", "effect": "solid", "params": {"color": "#00ff00"}}
+	  ],
+	  "initial": [{"step": "idle", "if": {"var": "level", "atLeast": 1}, "otherwise": "sweep"}]
+	}`
+	seq, err := ParseSequence([]byte(def), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	op := seq.steps["idle"].Next[0]
+	if len(op.Choices) != 2 || op.Choices[1].Weight != 1 || op.Limit != 5 || op.Otherwise != "sweep" {
+		t.Fatalf("Unexpected operation %+v", op)
+	}
+	if cond := seq.steps["idle"].Next[1].Condition; cond == nil || !cond(Vars{"faction": "ENL"}) || cond(Vars{}) {
+		t.Fatal("Expected condition on faction")
+	}
+	if err = seq.Validate(make([]uint, numShaftWindows)); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	for _, bad := range []string{
+		`{"steps": [{"name": "a", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#fff"}}],
+		  "initial": [{"step": "a", "if": {"var": "level"}}]}`,
+		`{"steps": [{"name": "a", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#fff"}}],
+		  "initial": [{"step": "a", "otherwise": "nowhere"}]}`,
+	} {
+		if _, err := ParseSequence([]byte(bad), TowerUniverses(), nil); err == nil {
+			t.Fatalf("Expected error parsing %s", bad)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package animation
+
+// Sources of time for sequences and the portal. Using something other than the
+// system clock allows animations to be rendered deterministically in tests, or
+// faster or slower than real time
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock giving the real, wall-clock time
+type SystemClock struct{}
+
+// Now gets the current system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock is a Clock which only moves when told to. Useful for tests
+type ManualClock struct {
+	now time.Time
+	sync.Mutex
+}
+
+// NewManualClock creates a ManualClock showing the given time
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now gets the clock's current time
+func (c *ManualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+// Set sets the clock's current time
+func (c *ManualClock) Set(t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = t
+}
+
+// Advance moves the clock on by d, returning the new time
+func (c *ManualClock) Advance(d time.Duration) time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// ScaledClock is a Clock running faster or slower than another clock. It starts
+// at the time shown by the other clock when it's created
+type ScaledClock struct {
+	base       Clock
+	factor     float64
+	baseOrigin time.Time // Time on the base clock when factor was last set
+	origin     time.Time // Time on this clock when factor was last set
+	sync.Mutex
+}
+
+// NewScaledClock creates a ScaledClock running factor times as fast as base:
+// 2.0 is double speed, 0.5 half speed
+func NewScaledClock(base Clock, factor float64) *ScaledClock {
+	now := base.Now()
+	return &ScaledClock{base: base, factor: factor, baseOrigin: now, origin: now}
+}
+
+// Now gets the clock's current time
+func (c *ScaledClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.nowInternal()
+}
+
+func (c *ScaledClock) nowInternal() time.Time {
+	return c.origin.Add(scaleDuration(c.base.Now().Sub(c.baseOrigin), c.factor))
+}
+
+// SetFactor changes the speed of the clock from now on, without it jumping
+func (c *ScaledClock) SetFactor(factor float64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.origin = c.nowInternal()
+	c.baseOrigin = c.base.Now()
+	c.factor = factor
+}
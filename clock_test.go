@@ -0,0 +1,90 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewManualClock(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("Clock should start at %v; got %v", start, c.Now())
+	}
+	if now := c.Advance(time.Second); !now.Equal(start.Add(time.Second)) || !c.Now().Equal(now) {
+		t.Fatalf("Unexpected time after advancing: %v", c.Now())
+	}
+}
+
+func TestScaledClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	base := NewManualClock(start)
+	c := NewScaledClock(base, 2.0)
+	base.Advance(time.Second)
+	if !c.Now().Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("Expected double-speed clock to show 2s; got %v", c.Now().Sub(start))
+	}
+	c.SetFactor(0.5)
+	base.Advance(time.Second)
+	if !c.Now().Equal(start.Add(2500 * time.Millisecond)) {
+		t.Fatalf("Expected clock to show 2.5s after slowing down; got %v", c.Now().Sub(start))
+	}
+}
+
+func TestRunnerManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	seq := NewSequence().
+		AddInitialStep("first", &Step{Effect: NewTimedSolid(white, 100*time.Millisecond)}).
+		AddStep("second", &Step{Effect: NewTimedSolid(black, 100*time.Millisecond)})
+	seq.steps["first"].ThenDo("second", 50*time.Millisecond)
+
+	sr := NewSequenceRunner([]uint{1})
+	sr.SetClock(clock)
+	sr.InitSequence(seq, clock.Now())
+
+	// Time only passes when the clock is advanced, however long the test takes
+	expected := []struct {
+		advance time.Duration
+		c       color.RGBA
+		done    bool
+	}{
+		{0, white, false},
+		{100 * time.Millisecond, white, false},
+		{1 * time.Millisecond, white, false}, // first completes; second scheduled for 151ms
+		{50 * time.Millisecond, white, false},
+		{1 * time.Millisecond, black, false}, // second started at 152ms
+		{100 * time.Millisecond, black, false},
+		{1 * time.Millisecond, black, false}, // second completes
+		{1 * time.Millisecond, black, true},
+	}
+	for idx, e := range expected {
+		clock.Advance(e.advance)
+		done := sr.Tick()
+		if c := sr.UniverseData(0)[0]; c != e.c || done != e.done {
+			t.Fatalf("Frame %d: expected %v, done %v; got %v, done %v", idx, e.c, e.done, c, done)
+		}
+	}
+}
+
+func TestPortalDeterministic(t *testing.T) {
+	frames := func() [][]color.RGBA {
+		clock := NewManualClock(time.Unix(1000, 0))
+		p := NewPortalWithClock(clock)
+		resos := make([]ResonatorStatus, numResos)
+		for idx := range resos {
+			resos[idx] = ResonatorStatus{Level: idx + 1, Health: 100.0}
+		}
+		p.UpdateStatus(&PortalStatus{Faction: ENL, Level: 5, Health: 100.0, Resonators: resos})
+		var out [][]color.RGBA
+		for i := 0; i < 20; i++ {
+			for _, ch := range p.GetFrame(clock.Advance(50 * time.Millisecond)) {
+				out = append(out, append([]color.RGBA(nil), ch.Data...))
+			}
+		}
+		return out
+	}
+	if !framesEqual(frames(), frames()) {
+		t.Fatalf("Portal output differs between identical runs")
+	}
+}
@@ -0,0 +1,325 @@
+package animation
+
+/*
+Combinators wrap an existing effect to alter its timing - looping it, playing
+it backwards, speeding it up, etc. They implement Animation themselves, so can
+be nested freely: e.g. NewLoop(NewPingPong(NewSpeed(effect, 2.0), time.Second))
+*/
+
+import (
+	"image/color"
+	"time"
+)
+
+// Loop restarts the wrapped effect each time it completes. It never completes
+// itself
+type Loop struct {
+	effect Animation
+}
+
+// NewLoop creates a Loop around the provided effect
+func NewLoop(effect Animation) *Loop {
+	return &Loop{effect: effect}
+}
+
+// Start starts the wrapped effect
+func (l *Loop) Start(startTime time.Time) {
+	l.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (l *Loop) Clone() Animation {
+	c := *l
+	c.effect = cloneEffect(l.effect)
+	return &c
+}
+
+// Frame generates a frame of the wrapped effect, restarting it if it completed
+func (l *Loop) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	output, done := l.effect.Frame(buf, frameTime)
+	if done {
+		l.effect.Start(frameTime)
+	}
+	return output, false
+}
+
+// Repeat plays the wrapped effect a fixed number of times, completing when the
+// last repetition does
+type Repeat struct {
+	effect    Animation
+	count     int
+	completed int
+}
+
+// NewRepeat creates a Repeat which plays the effect count times. With a count
+// below 1 it completes at once, without playing the effect at all
+func NewRepeat(effect Animation, count int) *Repeat {
+	return &Repeat{effect: effect, count: count}
+}
+
+// Start starts the first repetition
+func (r *Repeat) Start(startTime time.Time) {
+	r.completed = 0
+	if r.count < 1 {
+		return
+	}
+	r.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (r *Repeat) Clone() Animation {
+	c := *r
+	c.effect = cloneEffect(r.effect)
+	return &c
+}
+
+// Frame generates a frame of the current repetition
+func (r *Repeat) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if r.count < 1 {
+		return buf, true
+	}
+	output, done := r.effect.Frame(buf, frameTime)
+	if done {
+		r.completed++
+		if r.completed >= r.count {
+			return output, true
+		}
+		r.effect.Start(frameTime)
+	}
+	return output, false
+}
+
+// Reverse plays the wrapped effect backwards over the specified duration. The
+// wrapped effect should be one whose frames depend only upon elapsed time
+type Reverse struct {
+	effect    Animation
+	duration  time.Duration
+	startTime time.Time
+}
+
+// NewReverse creates a Reverse of the effect, which is assumed to last for
+// duration
+func NewReverse(effect Animation, duration time.Duration) *Reverse {
+	return &Reverse{effect: effect, duration: duration}
+}
+
+// Start starts the reversed effect
+func (r *Reverse) Start(startTime time.Time) {
+	r.startTime = startTime
+	r.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (r *Reverse) Clone() Animation {
+	c := *r
+	c.effect = cloneEffect(r.effect)
+	return &c
+}
+
+// Frame generates a frame of the effect, counting back from the end
+func (r *Reverse) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(r.startTime)
+	if elapsed > r.duration {
+		return buf, true
+	}
+	output, _ = r.effect.Frame(buf, r.startTime.Add(r.duration-elapsed))
+	return output, false
+}
+
+// Speed plays the wrapped effect faster or slower than normal
+type Speed struct {
+	effect    Animation
+	factor    float64
+	startTime time.Time
+}
+
+// NewSpeed creates a Speed, scaling the rate of time passing for the effect by
+// factor: 2.0 is double speed, 0.5 half speed
+func NewSpeed(effect Animation, factor float64) *Speed {
+	return &Speed{effect: effect, factor: factor}
+}
+
+// Start starts the wrapped effect
+func (s *Speed) Start(startTime time.Time) {
+	s.startTime = startTime
+	s.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (s *Speed) Clone() Animation {
+	c := *s
+	c.effect = cloneEffect(s.effect)
+	return &c
+}
+
+// Frame generates a frame of the wrapped effect at scaled time
+func (s *Speed) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(s.startTime)
+	return s.effect.Frame(buf, s.startTime.Add(scaleDuration(elapsed, s.factor)))
+}
+
+// Delay holds off the wrapped effect for a period of time. While waiting, the
+// buffer is left as it is
+type Delay struct {
+	effect    Animation
+	delay     time.Duration
+	startTime time.Time
+}
+
+// NewDelay creates a Delay, starting the effect after delay
+func NewDelay(effect Animation, delay time.Duration) *Delay {
+	return &Delay{effect: effect, delay: delay}
+}
+
+// Start starts the delay period
+func (d *Delay) Start(startTime time.Time) {
+	d.startTime = startTime
+	d.effect.Start(startTime.Add(d.delay))
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (d *Delay) Clone() Animation {
+	c := *d
+	c.effect = cloneEffect(d.effect)
+	return &c
+}
+
+// Frame generates a frame of the wrapped effect, once the delay has passed
+func (d *Delay) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if frameTime.Sub(d.startTime) < d.delay {
+		return buf, false
+	}
+	return d.effect.Frame(buf, frameTime)
+}
+
+// ClipTo limits the wrapped effect to a maximum duration. It completes when
+// the duration passes or the wrapped effect completes, whichever comes first
+type ClipTo struct {
+	effect    Animation
+	duration  time.Duration
+	startTime time.Time
+}
+
+// NewClipTo creates a ClipTo, limiting the effect to duration
+func NewClipTo(effect Animation, duration time.Duration) *ClipTo {
+	return &ClipTo{effect: effect, duration: duration}
+}
+
+// Start starts the wrapped effect
+func (c *ClipTo) Start(startTime time.Time) {
+	c.startTime = startTime
+	c.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (c *ClipTo) Clone() Animation {
+	clone := *c
+	clone.effect = cloneEffect(c.effect)
+	return &clone
+}
+
+// Frame generates a frame of the wrapped effect, until the duration passes
+func (c *ClipTo) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if frameTime.After(c.startTime.Add(c.duration)) {
+		return buf, true
+	}
+	return c.effect.Frame(buf, frameTime)
+}
+
+// PingPong plays the wrapped effect forward over a duration, then backwards
+// over the same duration. It completes after one round trip; wrap it in a Loop
+// to keep it going. As with Reverse, the wrapped effect should be one whose
+// frames depend only upon elapsed time
+type PingPong struct {
+	effect    Animation
+	duration  time.Duration
+	startTime time.Time
+}
+
+// NewPingPong creates a PingPong, with duration being the length of each
+// direction
+func NewPingPong(effect Animation, duration time.Duration) *PingPong {
+	return &PingPong{effect: effect, duration: duration}
+}
+
+// Start starts the wrapped effect
+func (p *PingPong) Start(startTime time.Time) {
+	p.startTime = startTime
+	p.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (p *PingPong) Clone() Animation {
+	c := *p
+	c.effect = cloneEffect(p.effect)
+	return &c
+}
+
+// Frame generates a frame of the wrapped effect, going forward then back
+func (p *PingPong) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(p.startTime)
+	if elapsed > 2*p.duration {
+		return buf, true
+	}
+	if elapsed > p.duration {
+		elapsed = 2*p.duration - elapsed
+	}
+	output, _ = p.effect.Frame(buf, p.startTime.Add(elapsed))
+	return output, false
+}
+
+// Crossfade fades from one effect to another over a duration. Both effects are
+// rendered during the fade; after it, only the second is. It completes when the
+// second effect completes. If the first effect completes during the fade, its
+// last frame is held
+type Crossfade struct {
+	from      Animation
+	to        Animation
+	duration  time.Duration
+	startTime time.Time
+	fromBuf   []color.RGBA
+	fromDone  bool
+}
+
+// NewCrossfade creates a Crossfade from one effect to another
+func NewCrossfade(from, to Animation, duration time.Duration) *Crossfade {
+	return &Crossfade{from: from, to: to, duration: duration}
+}
+
+// Start starts both effects
+func (c *Crossfade) Start(startTime time.Time) {
+	c.startTime = startTime
+	c.fromDone = false
+	c.from.Start(startTime)
+	c.to.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the two effects if possible
+func (c *Crossfade) Clone() Animation {
+	clone := &Crossfade{from: cloneEffect(c.from), to: cloneEffect(c.to), duration: c.duration}
+	return clone
+}
+
+// Frame generates a frame mixing the two effects
+func (c *Crossfade) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(c.startTime)
+	if elapsed >= c.duration {
+		return c.to.Frame(buf, frameTime)
+	}
+	if !c.fromDone {
+		c.fromBuf = append(c.fromBuf[:0], buf...)
+		c.fromBuf, c.fromDone = c.from.Frame(c.fromBuf, frameTime)
+	}
+	output, endSeq = c.to.Frame(buf, frameTime)
+	ratio := float64(elapsed) / float64(c.duration)
+	for idx := 0; idx < len(output) && idx < len(c.fromBuf); idx++ {
+		f, t := c.fromBuf[idx], output[idx]
+		output[idx] = color.RGBA{mix(f.R, t.R, ratio), mix(f.G, t.G, ratio), mix(f.B, t.B, ratio), mix(f.A, t.A, ratio)}
+	}
+	return output, endSeq
+}
+
+// scaleDuration multiplies a duration by a floating point factor
+func scaleDuration(d time.Duration, factor float64) time.Duration {
+	return time.Duration(float64(d) * factor)
+}
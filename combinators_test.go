@@ -0,0 +1,170 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+var (
+	black = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+func TestLoop(t *testing.T) {
+	effect := NewLoop(NewInterpolateSolid(black, white, 10*time.Millisecond))
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	for tick := 0; tick < 50; tick++ {
+		if _, done := effect.Frame(buf, now.Add(time.Duration(tick)*time.Millisecond)); done {
+			t.Fatalf("Loop completed at tick %d", tick)
+		}
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	effect := NewRepeat(NewTimedSolid(white, 2*time.Millisecond), 3)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	completions := 0
+	for tick := 0; tick < 20 && completions == 0; tick++ {
+		if _, done := effect.Frame(buf, now.Add(time.Duration(tick)*time.Millisecond)); done {
+			// Each repetition completes on the tick after its duration, and the
+			// next begins there
+			if tick != 9 {
+				t.Fatalf("Repeat completed at tick %d", tick)
+			}
+			completions++
+		}
+	}
+	if completions != 1 {
+		t.Fatal("Repeat never completed")
+	}
+}
+
+func TestRepeatNone(t *testing.T) {
+	for _, count := range []int{0, -1} {
+		effect := NewRepeat(NewSolid(white), count)
+		if d, known := DurationOf(effect); !known || d != 0 {
+			t.Fatalf("Count %d: expected duration 0; got %v (known %v)", count, d, known)
+		}
+		now := time.Unix(0, 0)
+		effect.Start(now)
+		out, done := effect.Frame(make([]color.RGBA, 1), now)
+		if !done {
+			t.Fatalf("Count %d: expected Repeat to complete at once", count)
+		}
+		if out[0] != (color.RGBA{}) {
+			t.Fatalf("Count %d: expected the effect not to be played; got %v", count, out[0])
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	effect := NewReverse(NewInterpolateSolid(black, white, 10*time.Millisecond), 10*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	if out, _ := effect.Frame(buf, now); out[0] != white {
+		t.Fatalf("Reverse didn't start with end color: %v", out[0])
+	}
+	if out, _ := effect.Frame(buf, now.Add(10*time.Millisecond)); out[0] != black {
+		t.Fatalf("Reverse didn't finish with start color: %v", out[0])
+	}
+	if _, done := effect.Frame(buf, now.Add(11*time.Millisecond)); !done {
+		t.Fatal("Reverse not done after duration")
+	}
+}
+
+func TestSpeedAndClip(t *testing.T) {
+	effect := NewClipTo(NewSpeed(NewInterpolateSolid(black, white, 10*time.Millisecond), 2.0), 3*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	out, _ := effect.Frame(buf, now.Add(2500*time.Microsecond))
+	if out[0].R != 0x80 {
+		t.Fatalf("Unexpected color at double speed: %v", out[0])
+	}
+	if _, done := effect.Frame(buf, now.Add(4*time.Millisecond)); !done {
+		t.Fatal("Clipped effect not done")
+	}
+}
+
+func TestDelayCombinator(t *testing.T) {
+	effect := NewDelay(NewSolid(white), 5*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := []color.RGBA{black}
+	if out, _ := effect.Frame(buf, now.Add(4*time.Millisecond)); out[0] != black {
+		t.Fatalf("Delayed effect ran early: %v", out[0])
+	}
+	if out, _ := effect.Frame(buf, now.Add(5*time.Millisecond)); out[0] != white {
+		t.Fatalf("Delayed effect didn't run: %v", out[0])
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	effect := NewPingPong(NewInterpolateSolid(black, white, 10*time.Millisecond), 10*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	for _, c := range []struct {
+		at       time.Duration
+		expected color.RGBA
+	}{
+		{0, black},
+		{10 * time.Millisecond, white},
+		{20 * time.Millisecond, black},
+	} {
+		if out, done := effect.Frame(buf, now.Add(c.at)); out[0] != c.expected || done {
+			t.Fatalf("At %v expected %v, got %v (done %v)", c.at, c.expected, out[0], done)
+		}
+	}
+	if _, done := effect.Frame(buf, now.Add(21*time.Millisecond)); !done {
+		t.Fatal("PingPong not done after round trip")
+	}
+}
+
+func TestCrossfade(t *testing.T) {
+	effect := NewCrossfade(NewSolid(black), NewTimedSolid(white, 20*time.Millisecond), 10*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	for _, c := range []struct {
+		at       time.Duration
+		expected uint8
+	}{
+		{0, 0x00},
+		{5 * time.Millisecond, 0x80},
+		{10 * time.Millisecond, 0xff},
+		{20 * time.Millisecond, 0xff},
+	} {
+		if out, done := effect.Frame(buf, now.Add(c.at)); out[0].R != c.expected || done {
+			t.Fatalf("At %v expected red %#x, got %v (done %v)", c.at, c.expected, out[0], done)
+		}
+	}
+	if _, done := effect.Frame(buf, now.Add(21*time.Millisecond)); !done {
+		t.Fatal("Crossfade not done when second effect completed")
+	}
+	if d, known := DurationOf(effect); !known || d != 20*time.Millisecond {
+		t.Fatalf("Unexpected duration %v (%v)", d, known)
+	}
+}
+
+func TestClone(t *testing.T) {
+	effect := NewLoop(NewInterpolateSolid(black, white, 100*time.Millisecond))
+	clone := effect.Clone()
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	clone.Start(now.Add(50 * time.Millisecond))
+	buf := make([]color.RGBA, 1)
+	// Each has its own state, including that of the wrapped effect
+	if out, _ := effect.Frame(buf, now.Add(50*time.Millisecond)); out[0].R != 0x80 {
+		t.Fatalf("Original should be half way through; got %v", out[0])
+	}
+	if out, _ := clone.Frame(buf, now.Add(50*time.Millisecond)); out[0].R != 0x00 {
+		t.Fatalf("Clone should be just starting; got %v", out[0])
+	}
+}
@@ -0,0 +1,177 @@
+package animation
+
+// Compositing of multiple layers of animation onto a single universe
+
+import (
+	"image/color"
+	"sort"
+)
+
+// BlendMode determines how a layer is combined with the layers beneath it
+type BlendMode int
+
+const (
+	// BlendNormal paints the layer over what's beneath, subject to opacity
+	BlendNormal BlendMode = iota
+	// BlendAdd adds channel values, saturating at full brightness
+	BlendAdd
+	// BlendMultiply multiplies channel values, darkening what's beneath
+	BlendMultiply
+	// BlendScreen is the inverse of multiply, lightening what's beneath
+	BlendScreen
+	// BlendMax takes the brighter of the layer and what's beneath, per channel
+	BlendMax
+	// BlendAlphaMask uses the brightness of the layer as a mask over what's
+	// beneath: black hides it, white leaves it untouched. The layer's own color
+	// isn't shown
+	BlendAlphaMask
+)
+
+func (mode BlendMode) String() string {
+	switch mode {
+	case BlendNormal:
+		return "normal"
+	case BlendAdd:
+		return "add"
+	case BlendMultiply:
+		return "multiply"
+	case BlendScreen:
+		return "screen"
+	case BlendMax:
+		return "max"
+	case BlendAlphaMask:
+		return "alphaMask"
+	}
+	return "unknown"
+}
+
+// BlendInto blends src onto dst, in place, using the specified mode. opacity
+// (0.0-1.0) scales the contribution of src, with 0.0 leaving dst untouched.
+// If the buffers differ in length, only the overlapping portion is blended
+func BlendInto(dst, src []color.RGBA, mode BlendMode, opacity float64) {
+	if opacity <= 0.0 {
+		return
+	}
+	if opacity > 1.0 {
+		opacity = 1.0
+	}
+	n := len(dst)
+	if len(src) < n {
+		n = len(src)
+	}
+	for idx := 0; idx < n; idx++ {
+		d, s := dst[idx], src[idx]
+		var b color.RGBA
+		if mode == BlendAlphaMask {
+			mask := uint32(luma(s))
+			b = color.RGBA{
+				uint8(uint32(d.R) * mask / 0xff),
+				uint8(uint32(d.G) * mask / 0xff),
+				uint8(uint32(d.B) * mask / 0xff),
+				uint8(uint32(d.A) * mask / 0xff),
+			}
+		} else {
+			b = color.RGBA{
+				blendChannel(d.R, s.R, mode),
+				blendChannel(d.G, s.G, mode),
+				blendChannel(d.B, s.B, mode),
+				blendChannel(d.A, s.A, mode),
+			}
+		}
+		if opacity < 1.0 {
+			b = color.RGBA{
+				mix(d.R, b.R, opacity),
+				mix(d.G, b.G, opacity),
+				mix(d.B, b.B, opacity),
+				mix(d.A, b.A, opacity),
+			}
+		}
+		dst[idx] = b
+	}
+}
+
+// blendChannel combines a single channel value d (beneath) with s (layer)
+func blendChannel(d, s uint8, mode BlendMode) uint8 {
+	switch mode {
+	case BlendAdd:
+		sum := uint16(d) + uint16(s)
+		if sum > 0xff {
+			return 0xff
+		}
+		return uint8(sum)
+	case BlendMultiply:
+		return uint8(uint16(d) * uint16(s) / 0xff)
+	case BlendScreen:
+		return 0xff - uint8(uint16(0xff-d)*uint16(0xff-s)/0xff)
+	case BlendMax:
+		if s > d {
+			return s
+		}
+		return d
+	}
+	// BlendNormal
+	return s
+}
+
+// mix linearly interpolates between a and b
+func mix(a, b uint8, ratio float64) uint8 {
+	return uint8(float64(a) + (float64(b)-float64(a))*ratio + 0.5)
+}
+
+// luma gives the perceived brightness of a color, 0-255
+func luma(c color.RGBA) uint8 {
+	return uint8((299*uint32(c.R) + 587*uint32(c.G) + 114*uint32(c.B)) / 1000)
+}
+
+// layer is a single compositing layer within a universe. Steps targeting the
+// layer are queued, with only the head of the queue being processed. Each layer
+// renders into its own buffer, which retains its content between steps
+type layer struct {
+	index      int          // Layer number - higher layers are composited on top
+	steps      []activeStep // Queue of steps for this layer
+	buf        []color.RGBA // Buffer the head step renders into
+	renderedBy *Step        // Step that rendered the layer in the current frame, if any
+}
+
+// layerStack is the set of layers for a universe, ordered from the bottom up.
+// The base layer (index 0) is always present
+type layerStack []*layer
+
+func newLayerStack(size uint) layerStack {
+	return layerStack{&layer{index: 0, steps: make([]activeStep, 0, 8), buf: make([]color.RGBA, size)}}
+}
+
+// get returns the layer with the given index, creating it if necessary
+func (ls *layerStack) get(index int) *layer {
+	pos := sort.Search(len(*ls), func(i int) bool { return (*ls)[i].index >= index })
+	if pos < len(*ls) && (*ls)[pos].index == index {
+		return (*ls)[pos]
+	}
+	l := &layer{
+		index: index,
+		steps: make([]activeStep, 0, 8),
+		buf:   make([]color.RGBA, len((*ls)[0].buf)),
+	}
+	*ls = append(*ls, nil)
+	copy((*ls)[pos+1:], (*ls)[pos:])
+	(*ls)[pos] = l
+	return l
+}
+
+// composite flattens the layer stack into out. The base layer is always
+// included, retaining its content when idle; higher layers are included only
+// if they rendered in the current frame
+func (ls layerStack) composite(out []color.RGBA) {
+	copy(out, ls[0].buf)
+	for _, l := range ls[1:] {
+		s := l.renderedBy
+		if s == nil {
+			continue
+		}
+		opacity := s.Opacity
+		if opacity == 0.0 {
+			opacity = 1.0
+		}
+		BlendInto(out, l.buf, s.Blend, opacity)
+	}
+}
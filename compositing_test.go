@@ -0,0 +1,65 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestBlendModes(t *testing.T) {
+	beneath := color.RGBA{0x80, 0x40, 0x00, 0xff}
+	over := color.RGBA{0x80, 0xff, 0x20, 0xff}
+	cases := []struct {
+		mode     BlendMode
+		opacity  float64
+		expected color.RGBA
+	}{
+		{BlendNormal, 1.0, over},
+		{BlendNormal, 0.5, color.RGBA{0x80, 0xa0, 0x10, 0xff}},
+		{BlendNormal, 0.0, beneath},
+		{BlendAdd, 1.0, color.RGBA{0xff, 0xff, 0x20, 0xff}},
+		{BlendMultiply, 1.0, color.RGBA{0x40, 0x40, 0x00, 0xff}},
+		{BlendScreen, 1.0, color.RGBA{0xc0, 0xff, 0x20, 0xff}},
+		{BlendMax, 1.0, color.RGBA{0x80, 0xff, 0x20, 0xff}},
+		{BlendAlphaMask, 1.0, color.RGBA{0x5f, 0x2f, 0x00, 0xbf}},
+	}
+	for _, c := range cases {
+		buf := []color.RGBA{beneath}
+		BlendInto(buf, []color.RGBA{over}, c.mode, c.opacity)
+		if buf[0] != c.expected {
+			t.Errorf("Blend %v at opacity %v: expected %v, got %v", c.mode, c.opacity, c.expected, buf[0])
+		}
+	}
+}
+
+func TestLayeredSteps(t *testing.T) {
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	blue := color.RGBA{0x00, 0x00, 0xff, 0xff}
+	base := &Step{UniverseID: 0, Effect: NewSolid(red)}
+	flash := &Step{UniverseID: 0, Effect: NewTimedSolid(blue, time.Minute), Layer: 1, Blend: BlendAdd}
+	seq := NewSequence().AddInitialStep("base", base).AddStep("flash", flash).
+		AddInitialOperation(NewOperation("flash", 2*time.Millisecond))
+	sr := NewSequenceRunner([]uint{3})
+	now := time.Now()
+	sr.InitSequence(seq, now)
+
+	sr.ProcessFrame(now)
+	if sr.UniverseData(0)[0] != red {
+		t.Fatalf("Base layer not shown alone: %v", sr.UniverseData(0)[0])
+	}
+
+	sr.ProcessFrame(now.Add(3 * time.Millisecond))
+	expected := color.RGBA{0xff, 0x00, 0xff, 0xff}
+	for idx, p := range sr.UniverseData(0) {
+		if p != expected {
+			t.Fatalf("Pixel %d not composited (%v)", idx, p)
+		}
+	}
+
+	// Once the flash is over, only the base layer should remain
+	sr.ProcessFrame(now.Add(2 * time.Minute))
+	sr.ProcessFrame(now.Add(2*time.Minute + time.Millisecond))
+	if sr.UniverseData(0)[0] != red {
+		t.Fatalf("Upper layer still shown after completion: %v", sr.UniverseData(0)[0])
+	}
+}
@@ -0,0 +1,70 @@
+package animation
+
+// Easing functions, which shape the progress of an effect over time
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+)
+
+// EasingFunc maps linear progress, 0.0-1.0, to eased progress. Eased progress
+// should also start at 0.0 and end at 1.0
+type EasingFunc func(t float64) float64
+
+// Easings contains the named easing functions
+var Easings = map[string]EasingFunc{
+	"linear":    func(t float64) float64 { return t },
+	"easeIn":    func(t float64) float64 { return t * t },
+	"easeOut":   func(t float64) float64 { return t * (2.0 - t) },
+	"easeInOut": func(t float64) float64 { return t * t * (3.0 - 2.0*t) },
+	"sine":      func(t float64) float64 { return 0.5 - math.Cos(math.Pi*t)/2.0 },
+}
+
+// LookupEasing finds an easing function by name
+func LookupEasing(name string) (EasingFunc, error) {
+	e, ok := Easings[name]
+	if !ok {
+		return nil, fmt.Errorf("\"%s\" is not a known easing", name)
+	}
+	return e, nil
+}
+
+// Eased applies an easing function to the timing of the wrapped effect over a
+// duration - typically the duration of the wrapped effect itself
+type Eased struct {
+	effect    Animation
+	easing    EasingFunc
+	duration  time.Duration
+	startTime time.Time
+}
+
+// NewEased creates an Eased around the effect
+func NewEased(effect Animation, easing EasingFunc, duration time.Duration) *Eased {
+	return &Eased{effect: effect, easing: easing, duration: duration}
+}
+
+// Start starts the wrapped effect
+func (e *Eased) Start(startTime time.Time) {
+	e.startTime = startTime
+	e.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (e *Eased) Clone() Animation {
+	c := *e
+	c.effect = cloneEffect(e.effect)
+	return &c
+}
+
+// Frame generates a frame of the wrapped effect at eased time. Once the
+// duration has passed, time proceeds normally
+func (e *Eased) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(e.startTime)
+	if elapsed >= 0 && elapsed <= e.duration && e.duration > 0 {
+		progress := e.easing(float64(elapsed) / float64(e.duration))
+		frameTime = e.startTime.Add(scaleDuration(e.duration, progress))
+	}
+	return e.effect.Frame(buf, frameTime)
+}
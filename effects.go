@@ -64,6 +64,12 @@ func (effect *InterpolateSolid) Start(startTime time.Time) {
 	}
 }
 
+// Clone creates an unstarted copy of the effect
+func (effect *InterpolateSolid) Clone() Animation {
+	c := *effect
+	return &c
+}
+
 // Frame generates an animation frame
 func (effect *InterpolateSolid) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
 	//fxlog.Printf("Buf cap: %d len: %d\n", cap(buf), len(buf))
@@ -93,6 +99,11 @@ func (effect *InterpolateSolid) Frame(buf []color.RGBA, frameTime time.Time) (ou
 	return buf, false
 }
 
+// Duration gives the length of the transition
+func (effect *InterpolateSolid) Duration() time.Duration {
+	return effect.duration
+}
+
 func colorfulToRGBA(c colorful.Color) color.RGBA {
 	r, g, b := c.RGB255()
 	return color.RGBA{r, g, b, 0xff}
@@ -139,6 +150,12 @@ func (effect *Pulse) Start(startTime time.Time) {
 	effect.startTime = startTime
 }
 
+// Clone creates an unstarted copy of the effect
+func (effect *Pulse) Clone() Animation {
+	c := *effect
+	return &c
+}
+
 // Frame generates a frame of the Pulse animation. It will always return 'false' for endSeq. It returns
 // the passed-in buffer
 func (effect *Pulse) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
@@ -156,6 +173,14 @@ func (effect *Pulse) Frame(buf []color.RGBA, frameTime time.Time) (output []colo
 	return buf, done
 }
 
+// Duration gives the length of a single-cycle pulse; other pulses run Forever
+func (effect *Pulse) Duration() time.Duration {
+	if effect.singleCycle {
+		return effect.period
+	}
+	return Forever
+}
+
 // Solid is a simple static solid color
 type Solid struct {
 	color     color.RGBA
@@ -186,6 +211,12 @@ func (effect *Solid) Start(startTime time.Time) {
 	effect.startTime = startTime
 }
 
+// Clone creates an unstarted copy of the effect
+func (effect *Solid) Clone() Animation {
+	c := *effect
+	return &c
+}
+
 // Frame creates a frame of the Solid effect
 func (effect *Solid) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
 	for idx := range buf {
@@ -194,3 +225,11 @@ func (effect *Solid) Frame(buf []color.RGBA, frameTime time.Time) (output []colo
 	done := effect.timed && frameTime.After(effect.startTime.Add(effect.duration))
 	return buf, done
 }
+
+// Duration gives the duration of a timed Solid; others run Forever
+func (effect *Solid) Duration() time.Duration {
+	if effect.timed {
+		return effect.duration
+	}
+	return Forever
+}
@@ -0,0 +1,116 @@
+package animation
+
+// Lifecycle events from a SequenceRunner, so callers can log, trigger sounds or
+// chain external actions without polling
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies the kind of a sequence event
+type EventType int
+
+const (
+	// StepStarted is sent when a step starts, on all its universes
+	StepStarted EventType = iota
+	// StepCompleted is sent when a step has completed on all its universes
+	StepCompleted
+	// OperationScheduled is sent when a delayed operation is scheduled
+	OperationScheduled
+	// SequenceCompleted is sent when the sequence has nothing left to run
+	SequenceCompleted
+	// SequenceReplaced is sent when a new sequence is started before the
+	// current one has completed
+	SequenceReplaced
+)
+
+func (et EventType) String() string {
+	switch et {
+	case StepStarted:
+		return "stepStarted"
+	case StepCompleted:
+		return "stepCompleted"
+	case OperationScheduled:
+		return "operationScheduled"
+	case SequenceCompleted:
+		return "sequenceCompleted"
+	case SequenceReplaced:
+		return "sequenceReplaced"
+	}
+	return "unknown"
+}
+
+// Event is a lifecycle event of a sequence. Times are in runner time
+type Event struct {
+	Type      EventType
+	Step      string    // Name of the step started, completed or scheduled, if any
+	Universes []uint    // Universes targeted by the step, if any
+	At        time.Time // When the event happened
+	RunAt     time.Time // When a scheduled operation will start its step
+}
+
+// Subscription receives events from a SequenceRunner. Events are delivered
+// without blocking the frame loop: if the channel's buffer is full, the event
+// is dropped and counted
+type Subscription struct {
+	Events  <-chan Event
+	events  chan Event
+	dropped int64
+}
+
+// Dropped gets the number of events dropped because the buffer was full
+func (sub *Subscription) Dropped() int {
+	return int(atomic.LoadInt64(&sub.dropped))
+}
+
+func (sub *Subscription) send(ev Event) {
+	select {
+	case sub.events <- ev:
+	default:
+		atomic.AddInt64(&sub.dropped, 1)
+	}
+}
+
+// Subscribe creates a subscription to the runner's events, buffering up to
+// bufSize of them
+func (sr *SequenceRunner) Subscribe(bufSize int) *Subscription {
+	sr.Lock()
+	defer sr.Unlock()
+
+	events := make(chan Event, bufSize)
+	sub := &Subscription{Events: events, events: events}
+	sr.subscribers = append(sr.subscribers, sub)
+	return sub
+}
+
+// Unsubscribe stops events going to a subscription, and closes its channel
+func (sr *SequenceRunner) Unsubscribe(sub *Subscription) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	for idx, s := range sr.subscribers {
+		if s == sub {
+			sr.subscribers = append(sr.subscribers[:idx], sr.subscribers[idx+1:]...)
+			close(sub.events)
+			return
+		}
+	}
+}
+
+// emit sends an event to all subscribers. While fast-forwarding, events up to
+// the position seeked from are held back, as they've been sent before
+func (sr *SequenceRunner) emit(ev Event) {
+	if sr.seeking && !ev.At.After(sr.seekFrom) {
+		return
+	}
+	if len(sr.subscribers) == 0 {
+		return
+	}
+	// The universes are often the step's or group's own slice, which
+	// subscribers mustn't be able to change
+	ev.Universes = append([]uint(nil), ev.Universes...)
+	for _, sub := range sr.subscribers {
+		sub.send(ev)
+	}
+}
@@ -0,0 +1,131 @@
+package animation
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Universes: []uint{0, 1}, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("b", &Step{UniverseID: 1, Effect: NewTimedSolid(white, 100*ms)})
+	seq.steps["a"].ThenDo("b", 50*ms)
+
+	sr := NewSequenceRunner([]uint{1, 1})
+	sub := sr.Subscribe(16)
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	for elapsed := time.Duration(0); elapsed <= 400*ms; elapsed += 10 * ms {
+		sr.ProcessFrame(start.Add(elapsed))
+	}
+	sr.InitSequence(seq, start.Add(410*ms))
+	sr.ProcessFrame(start.Add(420 * ms))
+	// Replacing a running sequence is reported
+	sr.InitSequence(seq, start.Add(430*ms))
+
+	expected := []struct {
+		et   EventType
+		step string
+		at   time.Duration
+	}{
+		{StepStarted, "a", 0},
+		{StepCompleted, "a", 110 * ms},
+		{OperationScheduled, "a", 110 * ms},
+		{StepStarted, "b", 170 * ms},
+		{StepCompleted, "b", 280 * ms},
+		{SequenceCompleted, "", 290 * ms},
+		{StepStarted, "a", 410 * ms},
+		{SequenceReplaced, "", 430 * ms},
+		{StepStarted, "a", 430 * ms},
+	}
+	for idx, e := range expected {
+		select {
+		case ev := <-sub.Events:
+			if ev.Type != e.et || !ev.At.Equal(start.Add(e.at)) {
+				t.Fatalf("Event %d: expected %v at %v; got %v at %v", idx, e.et, e.at, ev.Type, ev.At.Sub(start))
+			}
+			if e.et == OperationScheduled {
+				if ev.Step != "b" || !ev.RunAt.Equal(start.Add(160*ms)) {
+					t.Fatalf("Expected b to be scheduled for 160ms; got %+v", ev)
+				}
+			} else if ev.Step != e.step {
+				t.Fatalf("Event %d: expected step %q; got %q", idx, e.step, ev.Step)
+			}
+		default:
+			t.Fatalf("Event %d: expected %v; got nothing", idx, e.et)
+		}
+	}
+	if sub.Dropped() != 0 {
+		t.Fatalf("Unexpected dropped events: %d", sub.Dropped())
+	}
+
+	sr.Unsubscribe(sub)
+	if _, open := <-sub.Events; open {
+		t.Fatal("Expected channel to be closed on unsubscribing")
+	}
+}
+
+func TestEventUniversesCopied(t *testing.T) {
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Group: "g", Effect: NewTimedSolid(white, time.Second)}).
+		AddGroup("g", 0, 1)
+
+	sr := NewSequenceRunner([]uint{1, 1})
+	sub := sr.Subscribe(4)
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	ev := <-sub.Events
+	ev.Universes[0] = 7
+	if seq.groups["g"][0] != 0 {
+		t.Fatalf("Changing an event's universes changed the group to %v", seq.groups["g"])
+	}
+}
+
+func TestSeekEvents(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("b", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)})
+	seq.steps["a"].ThenDoImmediately("b")
+
+	sr := NewSequenceRunner([]uint{1})
+	sub := sr.Subscribe(16)
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start.Add(50 * ms))
+	<-sub.Events // a started
+
+	// Seeking forwards past the end reports what happened in the time skipped,
+	// including the sequence completing
+	sr.Seek(time.Second)
+	var got []EventType
+	for len(sub.Events) > 0 {
+		got = append(got, (<-sub.Events).Type)
+	}
+	expected := []EventType{StepCompleted, StepStarted, StepCompleted, SequenceCompleted}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("Expected events %v after seeking forwards; got %v", expected, got)
+	}
+
+	// Seeking backwards repeats nothing
+	sr.Seek(150 * ms)
+	if len(sub.Events) != 0 {
+		t.Fatalf("Expected no events after seeking backwards; got %v", <-sub.Events)
+	}
+}
+
+func TestEventsDropped(t *testing.T) {
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewSolid(white)}).
+		AddInitialStep("b", &Step{UniverseID: 0, Effect: NewSolid(white)})
+	sr := NewSequenceRunner([]uint{1})
+	sub := sr.Subscribe(1)
+	sr.InitSequence(seq, time.Unix(0, 0))
+	// Nobody's reading, so the second event is dropped rather than blocking
+	if sub.Dropped() != 1 || len(sub.Events) != 1 {
+		t.Fatalf("Expected one event delivered and one dropped; dropped %d", sub.Dropped())
+	}
+}
@@ -0,0 +1,475 @@
+package animation
+
+/*
+Exporting sequences for humans to look at: the step graph as Graphviz DOT,
+and a simulated timeline of which steps are active on each universe, as a
+table or SVG.
+
+The timeline is worked out from the steps' effect durations (see DurationOf)
+rather than by running the effects. Steps whose duration can't be determined
+are assumed to run until the end of the timeline. Branching operations are
+followed as if no variables were set, taking the most likely random choice.
+*/
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	colorful "github.com/lucasb-eyer/go-colorful"
+)
+
+// WriteDOT writes the step graph of the sequence in Graphviz DOT format. Steps
+// are grouped by universe, apart from those targeting several universes;
+// edges are labelled with their delays
+func (seq *Sequence) WriteDOT(w io.Writer) error {
+	names := seq.stepNames()
+	byUniverse := make(map[uint][]string)
+	universes := make([]uint, 0)
+	multi := make([]string, 0)
+	for _, name := range names {
+		targets := seq.targets(seq.steps[name])
+		if len(targets) != 1 {
+			multi = append(multi, name)
+			continue
+		}
+		u := targets[0]
+		if _, seen := byUniverse[u]; !seen {
+			universes = append(universes, u)
+		}
+		byUniverse[u] = append(byUniverse[u], name)
+	}
+	sort.Slice(universes, func(i, j int) bool { return universes[i] < universes[j] })
+
+	ew := &errWriter{w: w}
+	ew.printf("digraph sequence {\n")
+	ew.printf("\trankdir=LR;\n")
+	ew.printf("\tnode [shape=box];\n")
+	ew.printf("\t_start [shape=point];\n")
+	for _, u := range universes {
+		ew.printf("\tsubgraph cluster_universe%d {\n", u)
+		ew.printf("\t\tlabel=\"Universe %d\";\n", u)
+		for _, name := range byUniverse[u] {
+			ew.printf("\t\t%s [label=%s];\n", strconv.Quote(name), strconv.Quote(name+"\n"+describeEffect(seq.steps[name])))
+		}
+		ew.printf("\t}\n")
+	}
+	for _, name := range multi {
+		step := seq.steps[name]
+		targets := step.Group
+		if targets == "" {
+			targets = fmt.Sprint(seq.targets(step))
+		}
+		label := name + "\n" + describeEffect(step) + "\nuniverses " + targets
+		if step.Stagger > 0 {
+			label += ", stagger " + step.Stagger.String()
+		}
+		ew.printf("\t%s [label=%s, style=rounded];\n", strconv.Quote(name), strconv.Quote(label))
+	}
+	for idx := range seq.initialOperations {
+		writeDOTOperation(ew, "_start", &seq.initialOperations[idx])
+	}
+	for _, name := range names {
+		for idx := range seq.steps[name].Next {
+			writeDOTOperation(ew, strconv.Quote(name), &seq.steps[name].Next[idx])
+		}
+		if join := seq.steps[name].Join; join != nil {
+			// Joins are drawn dashed, labelled with how many steps they need
+			label := fmt.Sprintf("join %d of %d", join.needed(), len(join.Steps))
+			if join.Delay > 0 {
+				label += ", " + join.Delay.String()
+			}
+			for _, joined := range join.Steps {
+				ew.printf("\t%s -> %s [style=dashed, label=%s];\n", strconv.Quote(joined), strconv.Quote(name), strconv.Quote(label))
+			}
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+// writeDOTOperation writes the edges for an operation. Random choices are
+// labelled with their weights, and alternatives are drawn dotted
+func writeDOTOperation(ew *errWriter, from string, op *Operation) {
+	var notes []string
+	if op.Delay > 0 {
+		notes = append(notes, op.Delay.String())
+	}
+	if op.Condition != nil {
+		notes = append(notes, "if")
+	}
+	if op.Limit > 0 {
+		notes = append(notes, fmt.Sprintf("%d times", op.Limit))
+	}
+	if len(op.Choices) == 0 {
+		ew.printf("\t%s -> %s%s;\n", from, strconv.Quote(op.StepName), dotLabel(notes))
+	}
+	for _, c := range op.Choices {
+		ew.printf("\t%s -> %s%s;\n", from, strconv.Quote(c.StepName),
+			dotLabel(append(notes[:len(notes):len(notes)], "weight "+strconv.FormatFloat(c.Weight, 'g', -1, 64))))
+	}
+	if op.Otherwise != "" {
+		ew.printf("\t%s -> %s [style=dotted, label=\"otherwise\"];\n", from, strconv.Quote(op.Otherwise))
+	}
+}
+
+func dotLabel(notes []string) string {
+	if len(notes) == 0 {
+		return ""
+	}
+	return " [label=" + strconv.Quote(strings.Join(notes, ", ")) + "]"
+}
+
+// describeEffect gives a short description of a step's effect, for labels
+func describeEffect(step *Step) string {
+	if step.SubSequence != nil {
+		return fmt.Sprintf("sub-sequence (%d steps)", len(step.SubSequence.steps))
+	}
+	if step.Effect == nil && step.Factory == nil {
+		return "(no effect)"
+	}
+	effect := step.template()
+	desc := fmt.Sprintf("%T", effect)
+	if d, known := DurationOf(effect); known {
+		if d == Forever {
+			desc += " (forever)"
+		} else {
+			desc += " (" + d.String() + ")"
+		}
+	}
+	return desc
+}
+
+// stepNames lists the sequence's (non-nil) steps in alphabetical order
+func (seq *Sequence) stepNames() []string {
+	names := make([]string, 0, len(seq.steps))
+	for name, step := range seq.steps {
+		if step != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TimelineEntry records a period for which a step is active
+type TimelineEntry struct {
+	Step       string
+	Universe   uint
+	Layer      int
+	Start, End time.Duration // Offsets from the start of the sequence
+	Open       bool          // Was the step still running at the end of the timeline?
+}
+
+// Limit on the number of step activations simulated, in case of cycles of
+// steps that take no time
+const maxTimelineActivations = 100000
+
+// timelineActivation is a step activation in the timeline simulation
+type timelineActivation struct {
+	name      string
+	step      *Step
+	remaining int // Universes on which the step is yet to complete
+}
+
+// timelineActive is an activation on a single universe
+type timelineActive struct {
+	act     *timelineActivation
+	startAt time.Duration // When the universe starts showing the effect
+	end     time.Duration // When the effect completes, if it reaches the head of the queue in time
+	head    time.Duration // When it reached the head of its layer's queue
+}
+
+type timelineLayer struct {
+	universe uint
+	layer    int
+}
+
+type timelinePending struct {
+	at   time.Duration
+	name string
+}
+
+// Timeline simulates running the sequence for the given length of time,
+// returning the periods for which each step is active on each universe,
+// ordered by universe, layer and start time
+func (seq *Sequence) Timeline(window time.Duration) []TimelineEntry {
+	var entries []TimelineEntry
+	queues := make(map[timelineLayer][]*timelineActive)
+	var pending []timelinePending
+	joinWaiters := seq.joinWaiters()
+	joinCompleted := make(map[string]map[string]bool)
+	activations := 0
+	now := time.Duration(0)
+
+	// Branches are followed as they would be with no variables set, taking the
+	// most likely of any random choices
+	opCounts := make(map[*Operation]int)
+	resolve := func(op *Operation) Operation {
+		name := op.StepName
+		if len(op.Choices) > 0 {
+			name = mostLikely(op.Choices)
+		}
+		if op.Condition != nil && !op.Condition(Vars{}) {
+			name = op.Otherwise
+		} else if op.Limit > 0 && opCounts[op] >= op.Limit {
+			opCounts[op] = 0
+			name = op.Otherwise
+		} else if op.Limit > 0 {
+			opCounts[op]++
+		}
+		return Operation{StepName: name, Delay: op.Delay}
+	}
+	var process func(op Operation)
+	var complete func(act *timelineActivation)
+	process = func(op Operation) {
+		step := seq.steps[op.StepName]
+		if step == nil || activations >= maxTimelineActivations {
+			return
+		}
+		if op.Delay > 0 {
+			pending = append(pending, timelinePending{now + op.Delay, op.StepName})
+			return
+		}
+		activations++
+		targets := seq.targets(step)
+		act := &timelineActivation{name: op.StepName, step: step, remaining: len(targets)}
+		if len(targets) == 0 {
+			complete(act)
+			return
+		}
+		d, known := Forever, false
+		if step.SubSequence != nil {
+			if !step.SubSequence.contains(seq) {
+				d, known = step.SubSequence.duration(window - now)
+			}
+		} else if step.Effect != nil || step.Factory != nil {
+			d, known = DurationOf(step.template())
+		}
+		independent := step.Instances == IndependentInstances && step.fresh()
+		for idx, universeID := range targets {
+			a := &timelineActive{act: act, startAt: now + time.Duration(idx)*step.Stagger, head: now}
+			effectStart := now
+			if independent {
+				effectStart = a.startAt
+			}
+			a.end = effectStart + d
+			if !known || d == Forever || a.end > window {
+				a.end = Forever
+			}
+			key := timelineLayer{universeID, step.Layer}
+			queues[key] = append(queues[key], a)
+		}
+	}
+	complete = func(act *timelineActivation) {
+		for idx := range act.step.Next {
+			process(resolve(&act.step.Next[idx]))
+		}
+		for _, waiter := range joinWaiters[act.name] {
+			if joinCompleted[waiter] == nil {
+				joinCompleted[waiter] = make(map[string]bool)
+			}
+			joinCompleted[waiter][act.name] = true
+			join := seq.steps[waiter].Join
+			if len(joinCompleted[waiter]) >= join.needed() {
+				joinCompleted[waiter] = nil
+				process(Operation{StepName: waiter, Delay: join.Delay})
+			}
+		}
+	}
+	completion := func(a *timelineActive) time.Duration {
+		if a.end < a.head {
+			return a.head
+		}
+		return a.end
+	}
+	shownFrom := func(a *timelineActive) time.Duration {
+		if a.startAt > a.head {
+			return a.startAt
+		}
+		return a.head
+	}
+
+	for idx := range seq.initialOperations {
+		process(resolve(&seq.initialOperations[idx]))
+	}
+	for {
+		// Find the next thing to happen
+		next := Forever
+		for _, p := range pending {
+			if p.at < next {
+				next = p.at
+			}
+		}
+		for _, q := range queues {
+			if len(q) > 0 {
+				if c := completion(q[0]); c < next {
+					next = c
+				}
+			}
+		}
+		if next > window {
+			break
+		}
+		now = next
+
+		// Complete steps, in a consistent order
+		keys := make([]timelineLayer, 0, len(queues))
+		for key := range queues {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].universe < keys[j].universe ||
+				(keys[i].universe == keys[j].universe && keys[i].layer < keys[j].layer)
+		})
+		for _, key := range keys {
+			q := queues[key]
+			if len(q) == 0 || completion(q[0]) != now {
+				continue
+			}
+			done := q[0]
+			queues[key] = q[1:]
+			if len(q) > 1 {
+				q[1].head = now
+			}
+			if from := shownFrom(done); from < now {
+				entries = append(entries, TimelineEntry{done.act.name, key.universe, key.layer, from, now, false})
+			}
+			done.act.remaining--
+			if done.act.remaining == 0 {
+				complete(done.act)
+			}
+		}
+		// Run due operations
+		remaining := pending[:0]
+		var due []timelinePending
+		for _, p := range pending {
+			if p.at == now {
+				due = append(due, p)
+			} else {
+				remaining = append(remaining, p)
+			}
+		}
+		pending = remaining
+		for _, p := range due {
+			process(Operation{StepName: p.name})
+		}
+	}
+
+	// Anything still running is open-ended
+	for key, q := range queues {
+		if len(q) > 0 {
+			if from := shownFrom(q[0]); from < window {
+				entries = append(entries, TimelineEntry{q[0].act.name, key.universe, key.layer, from, window, true})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Universe != b.Universe {
+			return a.Universe < b.Universe
+		}
+		if a.Layer != b.Layer {
+			return a.Layer < b.Layer
+		}
+		return a.Start < b.Start
+	})
+	return entries
+}
+
+// WriteTimelineTable writes timeline entries as a plain text table
+func WriteTimelineTable(w io.Writer, entries []TimelineEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "UNIVERSE\tLAYER\tSTEP\tSTART\tEND")
+	for _, e := range entries {
+		end := e.End.String()
+		if e.Open {
+			end += "+"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%v\t%s\n", e.Universe, e.Layer, e.Step, e.Start, end)
+	}
+	return tw.Flush()
+}
+
+// Dimensions of the timeline SVG
+const (
+	svgLabelWidth = 120
+	svgWidth      = 1000
+	svgRowHeight  = 24
+)
+
+// WriteTimelineSVG draws timeline entries as an SVG image, with a row for each
+// universe and layer, and time running left to right up to window
+func WriteTimelineSVG(w io.Writer, entries []TimelineEntry, window time.Duration) error {
+	rows := make(map[timelineLayer]int)
+	keys := make([]timelineLayer, 0)
+	for _, e := range entries {
+		key := timelineLayer{e.Universe, e.Layer}
+		if _, seen := rows[key]; !seen {
+			rows[key] = len(keys)
+			keys = append(keys, key)
+		}
+	}
+	scale := func(d time.Duration) float64 {
+		if window <= 0 {
+			return svgLabelWidth
+		}
+		return svgLabelWidth + float64(d)/float64(window)*float64(svgWidth-svgLabelWidth)
+	}
+
+	ew := &errWriter{w: w}
+	ew.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"11\">\n",
+		svgWidth, (len(keys)+1)*svgRowHeight)
+	for idx, key := range keys {
+		ew.printf("<text x=\"4\" y=\"%d\">universe %d layer %d</text>\n", idx*svgRowHeight+16, key.universe, key.layer)
+	}
+	for _, e := range entries {
+		y := rows[timelineLayer{e.Universe, e.Layer}] * svgRowHeight
+		x := scale(e.Start)
+		name := html.EscapeString(e.Step)
+		ew.printf("<g><title>%s: %v - %v</title>", name, e.Start, e.End)
+		ew.printf("<rect x=\"%.1f\" y=\"%d\" width=\"%.1f\" height=\"%d\" fill=\"%s\" stroke=\"black\"/>",
+			x, y+2, scale(e.End)-x, svgRowHeight-4, stepColor(e.Step))
+		ew.printf("<text x=\"%.1f\" y=\"%d\">%s</text></g>\n", x+2, y+16, name)
+	}
+	// Time axis, with ticks at a power of ten seconds giving a sensible number
+	axisY := len(keys) * svgRowHeight
+	ew.printf("<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n", svgLabelWidth, axisY, svgWidth, axisY)
+	tick := time.Second
+	for window/tick > 20 {
+		tick *= 10
+	}
+	for window/tick < 2 && tick > time.Millisecond {
+		tick /= 10
+	}
+	for t := time.Duration(0); t <= window; t += tick {
+		ew.printf("<text x=\"%.1f\" y=\"%d\">%v</text>\n", scale(t), axisY+16, t)
+	}
+	ew.printf("</svg>\n")
+	return ew.err
+}
+
+// stepColor picks a light color for a step, consistently from its name
+func stepColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return colorful.Hsv(float64(h.Sum32()%360), 0.35, 0.95).Hex()
+}
+
+// errWriter writes formatted output, remembering the first error
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
@@ -0,0 +1,89 @@
+package animation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDOT(t *testing.T) {
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Effect: NewTimedSolid(white, time.Second)}).
+		AddStep("b", &Step{UniverseID: 1, Effect: NewSolid(black)})
+	seq.steps["a"].ThenDo("b", 500*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := seq.WriteDOT(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dot := buf.String()
+	for _, expected := range []string{
+		"digraph sequence {",
+		"subgraph cluster_universe0 {",
+		"subgraph cluster_universe1 {",
+		`"a" [label="a\n*animation.Solid (1s)"];`,
+		`"b" [label="b\n*animation.Solid (forever)"];`,
+		`_start -> "a";`,
+		`"a" -> "b" [label="500ms"];`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Fatalf("Expected DOT output to contain %s; got\n%s", expected, dot)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Effect: NewTimedSolid(white, time.Second)}).
+		AddInitialStep("c", &Step{Effect: NewTimedSolid(white, 2*time.Second)}).
+		AddInitialStep("d", &Step{UniverseID: 1, Effect: NewSolid(white)}).
+		AddStep("b", &Step{UniverseID: 1, Layer: 1, Effect: NewTimedSolid(white, time.Second)}).
+		AddStep("e", &Step{Effect: NewTimedSolid(white, time.Second)})
+	seq.steps["a"].ThenDo("b", 500*time.Millisecond)
+	seq.steps["b"].ThenDoImmediately("e")
+
+	ms := time.Millisecond
+	entries := seq.Timeline(3 * time.Second)
+	expected := []TimelineEntry{
+		{"a", 0, 0, 0, 1000 * ms, false},
+		// c was started along with a, so completes 2s after the start, despite
+		// being queued behind a
+		{"c", 0, 0, 1000 * ms, 2000 * ms, false},
+		{"e", 0, 0, 2500 * ms, 3000 * ms, true},
+		{"d", 1, 0, 0, 3000 * ms, true},
+		{"b", 1, 1, 1500 * ms, 2500 * ms, false},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries; got %+v", len(expected), entries)
+	}
+	for idx, e := range expected {
+		if entries[idx] != e {
+			var table bytes.Buffer
+			WriteTimelineTable(&table, entries)
+			t.Fatalf("Entry %d: expected %+v; timeline is\n%s", idx, e, table.String())
+		}
+	}
+}
+
+func TestTimelineOutput(t *testing.T) {
+	entries := createFadePulseSeq(white, time.Second).Timeline(3 * time.Second)
+	if len(entries) != 2*numShaftWindows {
+		t.Fatalf("Expected %d entries; got %d", 2*numShaftWindows, len(entries))
+	}
+	var buf bytes.Buffer
+	if err := WriteTimelineTable(&buf, entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Count(buf.String(), "pulse") != numShaftWindows {
+		t.Fatalf("Table missing steps:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := WriteTimelineSVG(&buf, entries, 3*time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<rect") != len(entries) {
+		t.Fatalf("Unexpected SVG:\n%s", svg)
+	}
+}
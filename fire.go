@@ -0,0 +1,162 @@
+package animation
+
+// Procedural fire and plasma effects
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// Maximum amount of heat lost per pixel per simulation step, scaled by the
+	// inverse of the universe size so taller fires burn higher
+	fireCooling = 0.55
+	// How many of the lowest pixels sparks can appear in
+	fireSparkZone = 7
+	// Limit on simulation steps performed in a single frame, so that a long gap
+	// between frames doesn't stall rendering
+	fireMaxCatchUp = 100
+)
+
+// Fire is a 1D fire simulation: heat is added as sparks at the start of the
+// universe, rises towards the end while diffusing, and cools as it goes. Heat
+// is mapped to color through a gradient, from cold to hot
+type Fire struct {
+	gradient  Gradient
+	intensity float64
+	interval  time.Duration
+	rng       *rand.Rand
+	heat      []float64
+	lastStep  time.Time
+}
+
+// NewFire creates a Fire effect. intensity (0.0-1.0) is the likelihood of a
+// new spark on each simulation step; speed is the number of simulation steps
+// per second. The simulation runs at this fixed rate regardless of frame rate
+func NewFire(gradient Gradient, intensity, speed float64, rng *rand.Rand) *Fire {
+	if speed <= 0 {
+		speed = 1.0
+	}
+	return &Fire{
+		gradient:  gradient,
+		intensity: intensity,
+		interval:  time.Duration(float64(time.Second) / speed),
+		rng:       rng,
+	}
+}
+
+// Start sets the start time of the Fire effect, with the fire initially cold
+func (effect *Fire) Start(startTime time.Time) {
+	effect.lastStep = startTime
+	for idx := range effect.heat {
+		effect.heat[idx] = 0.0
+	}
+}
+
+// Clone creates an unstarted copy of the effect, with a random source of its
+// own seeded from this one's
+func (effect *Fire) Clone() Animation {
+	c := *effect
+	c.rng = forkRand(effect.rng)
+	c.heat = nil
+	return &c
+}
+
+// Frame creates a frame of the Fire effect. It never completes
+func (effect *Fire) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if len(effect.heat) != len(buf) {
+		effect.heat = make([]float64, len(buf))
+	}
+	for steps := fixedSteps(&effect.lastStep, frameTime, effect.interval, fireMaxCatchUp); steps > 0; steps-- {
+		effect.step()
+	}
+	for idx, h := range effect.heat {
+		buf[idx] = effect.gradient.At(h)
+	}
+	return buf, false
+}
+
+// fixedSteps works out how many fixed-size steps a simulation should take to
+// reach now, advancing last past all the intervals elapsed. At most max steps
+// are taken, so the simulation skips ahead after a long gap rather than
+// catching up step by step
+func fixedSteps(last *time.Time, now time.Time, interval time.Duration, max int) int {
+	elapsed := now.Sub(*last)
+	if interval <= 0 || elapsed < interval {
+		return 0
+	}
+	due := elapsed / interval
+	*last = last.Add(due * interval)
+	if due > time.Duration(max) {
+		return max
+	}
+	return int(due)
+}
+
+// step advances the fire simulation by one step
+func (effect *Fire) step() {
+	heat := effect.heat
+	n := len(heat)
+	if n == 0 {
+		return
+	}
+	// Cool every pixel a little
+	maxCool := fireCooling*10.0/float64(n)/255.0 + 2.0/255.0
+	for idx := range heat {
+		heat[idx] = math.Max(0.0, heat[idx]-effect.rng.Float64()*maxCool)
+	}
+	// Heat drifts up and diffuses
+	for idx := n - 1; idx >= 2; idx-- {
+		heat[idx] = (heat[idx-1] + 2*heat[idx-2]) / 3.0
+	}
+	// Randomly ignite new sparks near the bottom
+	if effect.rng.Float64() < effect.intensity {
+		zone := fireSparkZone
+		if zone > n {
+			zone = n
+		}
+		idx := effect.rng.Intn(zone)
+		heat[idx] = math.Min(1.0, heat[idx]+0.6+effect.rng.Float64()*0.4)
+	}
+}
+
+// Plasma is a smoothly-flowing pattern formed by summing sine waves of
+// different frequencies, mapped to colors through a gradient
+type Plasma struct {
+	gradient  Gradient
+	intensity float64
+	speed     float64
+	startTime time.Time
+}
+
+// NewPlasma creates a Plasma effect. intensity (0.0-1.0) scales the brightness
+// of the output; speed is the rate of flow, with 1.0 being a gentle drift
+func NewPlasma(gradient Gradient, intensity, speed float64) *Plasma {
+	return &Plasma{gradient: gradient, intensity: intensity, speed: speed}
+}
+
+// Start sets the start time of the Plasma effect
+func (effect *Plasma) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *Plasma) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the Plasma effect. It never completes
+func (effect *Plasma) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	t := frameTime.Sub(effect.startTime).Seconds() * effect.speed
+	wobble := 8.0 * math.Sin(t/2.0)
+	for idx := range buf {
+		x := float64(idx)
+		v := math.Sin(x/4.0+t) + math.Sin(x/7.0-1.3*t) + math.Sin((x+wobble)/5.0)
+		// v is in the range -3 to 3; map it onto the gradient
+		buf[idx] = scaleColor(effect.gradient.At((v+3.0)/6.0), effect.intensity)
+	}
+	return buf, false
+}
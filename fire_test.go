@@ -0,0 +1,88 @@
+package animation
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestFire(t *testing.T) {
+	effect := NewFire(Palettes["fire"].Gradient(), 1.0, 60.0, rand.New(rand.NewSource(1)))
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, windowSize)
+	out, _ := effect.Frame(buf, now)
+	for idx, p := range out {
+		if p != Palettes["fire"][0] {
+			t.Fatalf("Pixel %d not cold at start: %v", idx, p)
+		}
+	}
+
+	out, _ = effect.Frame(buf, now.Add(time.Second))
+	lit := 0
+	for _, p := range out {
+		if p != Palettes["fire"][0] {
+			lit++
+		}
+	}
+	if lit == 0 {
+		t.Fatal("Fire didn't ignite")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		now = now.Add(20 * time.Millisecond)
+		effect.Frame(buf, now)
+	})
+	if allocs > 0 {
+		t.Fatalf("Fire allocated %v times per frame", allocs)
+	}
+}
+
+func TestFixedSteps(t *testing.T) {
+	last := time.Unix(0, 0)
+	if steps := fixedSteps(&last, time.Unix(0, 0).Add(25*time.Millisecond), 10*time.Millisecond, 100); steps != 2 {
+		t.Fatalf("Expected 2 steps; got %d", steps)
+	}
+	if !last.Equal(time.Unix(0, 0).Add(20 * time.Millisecond)) {
+		t.Fatalf("Last step not advanced to the last whole interval: %v", last)
+	}
+	// A long gap skips ahead in one go, only simulating the maximum
+	now := last.Add(10000 * time.Hour)
+	if steps := fixedSteps(&last, now, 10*time.Millisecond, 100); steps != 100 {
+		t.Fatalf("Expected the maximum of 100 steps; got %d", steps)
+	}
+	if !last.Equal(now) {
+		t.Fatalf("Last step not advanced past the gap: %v", last)
+	}
+}
+
+func TestPlasma(t *testing.T) {
+	effect := NewPlasma(Palettes["res"].Gradient(), 0.0, 1.0)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	out, _ := effect.Frame(make([]color.RGBA, windowSize), now.Add(time.Second))
+	for idx, p := range out {
+		if p.R != 0 || p.G != 0 || p.B != 0 {
+			t.Fatalf("Pixel %d not dark at zero intensity: %v", idx, p)
+		}
+	}
+}
+
+func BenchmarkFireTower(b *testing.B) {
+	effects := make([]*Fire, numShaftWindows)
+	bufs := make([][]color.RGBA, numShaftWindows)
+	now := time.Unix(0, 0)
+	for idx := range effects {
+		effects[idx] = NewFire(Palettes["fire"].Gradient(), 0.5, 60.0, rand.New(rand.NewSource(int64(idx))))
+		effects[idx].Start(now)
+		bufs[idx] = make([]color.RGBA, windowSize)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now = now.Add(16 * time.Millisecond)
+		for idx, effect := range effects {
+			effect.Frame(bufs[idx], now)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package animation
+
+// Playback of animations sketched as images - animated GIFs, or PNG 'strips'
+// in which each row of pixels is a frame
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"time"
+)
+
+// Delay used for GIF frames which don't specify one, as browsers do
+const defaultGIFDelay = 100 * time.Millisecond
+
+// ScaleMode determines how the columns of an image are mapped onto the pixels
+// of a universe
+type ScaleMode int
+
+const (
+	// ScaleNone maps one column to each pixel. Surplus columns are ignored;
+	// surplus pixels are black
+	ScaleNone ScaleMode = iota
+	// ScaleNearest stretches or squashes the image to fit, using the nearest
+	// column for each pixel
+	ScaleNearest
+	// ScaleLinear stretches or squashes the image to fit, blending between
+	// columns
+	ScaleLinear
+)
+
+// ImageClip is a sequence of image frames, each with a duration
+type ImageClip struct {
+	frames []*image.RGBA
+	delays []time.Duration
+	total  time.Duration
+}
+
+// NewImageClip creates an ImageClip from a set of frames, and the time each
+// should be shown for. All frames are expected to be the same size
+func NewImageClip(frames []image.Image, delays []time.Duration) (*ImageClip, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("image clip has no frames")
+	}
+	if len(frames) != len(delays) {
+		return nil, errors.New("image clip must have a delay for each frame")
+	}
+	clip := &ImageClip{
+		frames: make([]*image.RGBA, len(frames)),
+		delays: delays,
+	}
+	for idx, f := range frames {
+		clip.frames[idx] = toRGBA(f)
+		clip.total += delays[idx]
+	}
+	return clip, nil
+}
+
+// LoadGIF loads an ImageClip from an animated GIF, with frame timing taken
+// from the GIF
+func LoadGIF(r io.Reader) (*ImageClip, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	frames := make([]image.Image, len(g.Image))
+	delays := make([]time.Duration, len(g.Image))
+	for idx, paletted := range g.Image {
+		// GIF frames may only cover part of the image, and are drawn over what
+		// came before according to their disposal method
+		var previous *image.RGBA
+		disposal := byte(0)
+		if idx < len(g.Disposal) {
+			disposal = g.Disposal[idx]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = toRGBA(canvas)
+		}
+		draw.Draw(canvas, paletted.Bounds(), paletted, paletted.Bounds().Min, draw.Over)
+		frames[idx] = toRGBA(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, paletted.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+
+		delays[idx] = defaultGIFDelay
+		if idx < len(g.Delay) && g.Delay[idx] > 0 {
+			delays[idx] = time.Duration(g.Delay[idx]) * 10 * time.Millisecond
+		}
+	}
+	return NewImageClip(frames, delays)
+}
+
+// LoadPNGStrip loads an ImageClip from a PNG in which each row of pixels is a
+// frame, with time running down the image. Each frame lasts for frameDuration
+func LoadPNGStrip(r io.Reader, frameDuration time.Duration) (*ImageClip, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	rgba := toRGBA(img)
+	bounds := rgba.Bounds()
+	frames := make([]image.Image, bounds.Dy())
+	delays := make([]time.Duration, bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		frames[y-bounds.Min.Y] = rgba.SubImage(image.Rect(bounds.Min.X, y, bounds.Max.X, y+1))
+		delays[y-bounds.Min.Y] = frameDuration
+	}
+	return NewImageClip(frames, delays)
+}
+
+// toRGBA copies an image into a new RGBA image with origin (0, 0)
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// Duration gives the total length of the clip
+func (clip *ImageClip) Duration() time.Duration {
+	return clip.total
+}
+
+// Rows gives the number of rows of pixels in each frame of the clip
+func (clip *ImageClip) Rows() int {
+	return clip.frames[0].Bounds().Dy()
+}
+
+// frameAt finds the frame to show at the given offset into the clip
+func (clip *ImageClip) frameAt(offset time.Duration) *image.RGBA {
+	for idx, d := range clip.delays {
+		if offset < d {
+			return clip.frames[idx]
+		}
+		offset -= d
+	}
+	return clip.frames[len(clip.frames)-1]
+}
+
+// ImagePlayback is an effect which plays a single row of an ImageClip onto a
+// universe, mapping the columns of the row to pixels
+type ImagePlayback struct {
+	clip      *ImageClip
+	row       int
+	scale     ScaleMode
+	loop      bool
+	startTime time.Time
+}
+
+// NewImagePlayback creates an ImagePlayback of the given row of the clip. If
+// loop is set, the clip repeats indefinitely; otherwise the effect completes
+// at the end of the clip
+func NewImagePlayback(clip *ImageClip, row int, scale ScaleMode, loop bool) *ImagePlayback {
+	return &ImagePlayback{clip: clip, row: row, scale: scale, loop: loop}
+}
+
+// NewImagePlaybacks creates an ImagePlayback for each of count universes - the
+// tower windows, for example - spreading the rows of the clip across them.
+// All the playbacks should be started at the same time to stay in step
+func NewImagePlaybacks(clip *ImageClip, count int, scale ScaleMode, loop bool) []*ImagePlayback {
+	playbacks := make([]*ImagePlayback, count)
+	for idx := range playbacks {
+		playbacks[idx] = NewImagePlayback(clip, idx*clip.Rows()/count, scale, loop)
+	}
+	return playbacks
+}
+
+// Start sets the start time of the ImagePlayback effect
+func (effect *ImagePlayback) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the playback, sharing its clip
+func (effect *ImagePlayback) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the ImagePlayback effect
+func (effect *ImagePlayback) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(effect.startTime)
+	total := effect.clip.Duration()
+	done := false
+	if elapsed >= total {
+		if effect.loop && total > 0 {
+			elapsed %= total
+		} else {
+			done = elapsed > total
+		}
+	}
+	img := effect.clip.frameAt(elapsed)
+	width := img.Bounds().Dx()
+	y := effect.row
+
+	for idx := range buf {
+		switch effect.scale {
+		case ScaleNearest:
+			buf[idx] = img.RGBAAt(idx*width/len(buf), y)
+		case ScaleLinear:
+			pos := 0.0
+			if len(buf) > 1 {
+				pos = float64(idx) * float64(width-1) / float64(len(buf)-1)
+			}
+			x := int(pos)
+			next := x + 1
+			if next >= width {
+				next = x
+			}
+			buf[idx] = blendRGBA(img.RGBAAt(x, y), img.RGBAAt(next, y), pos-float64(x))
+		default:
+			if idx < width {
+				buf[idx] = img.RGBAAt(idx, y)
+			} else {
+				buf[idx] = color.RGBA{0, 0, 0, 0xff}
+			}
+		}
+	}
+	return buf, done
+}
+
+// Duration gives the length of the clip, or Forever if it loops
+func (effect *ImagePlayback) Duration() time.Duration {
+	if effect.loop {
+		return Forever
+	}
+	return effect.clip.Duration()
+}
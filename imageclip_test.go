@@ -0,0 +1,109 @@
+package animation
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestPNGStrip(t *testing.T) {
+	// Two frames, each 4 pixels wide: a red->black ramp, then solid green
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{uint8(0xff - x*0x55), 0, 0, 0xff})
+		img.Set(x, 1, color.RGBA{0, 0xff, 0, 0xff})
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	clip, err := LoadPNGStrip(&b, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Duration() != 200*time.Millisecond || clip.Rows() != 1 {
+		t.Fatalf("Unexpected clip duration %v, rows %d", clip.Duration(), clip.Rows())
+	}
+
+	effect := NewImagePlayback(clip, 0, ScaleNone, false)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	out, _ := effect.Frame(make([]color.RGBA, 6), now)
+	checkReds(t, "unscaled", out, []uint8{0xff, 0xaa, 0x55, 0x00, 0x00, 0x00})
+
+	effect = NewImagePlayback(clip, 0, ScaleNearest, false)
+	effect.Start(now)
+	out, _ = effect.Frame(make([]color.RGBA, 2), now)
+	checkReds(t, "nearest", out, []uint8{0xff, 0x55})
+
+	effect = NewImagePlayback(clip, 0, ScaleLinear, false)
+	effect.Start(now)
+	out, _ = effect.Frame(make([]color.RGBA, 7), now)
+	checkReds(t, "linear", out, []uint8{0xff, 0xd5, 0xaa, 0x80, 0x55, 0x2b, 0x00})
+
+	out, done := effect.Frame(make([]color.RGBA, 2), now.Add(150*time.Millisecond))
+	if done || out[0].G != 0xff {
+		t.Fatalf("Second frame not shown: %v", out)
+	}
+	if _, done = effect.Frame(make([]color.RGBA, 2), now.Add(201*time.Millisecond)); !done {
+		t.Fatal("Not done at end of clip")
+	}
+}
+
+func TestGIF(t *testing.T) {
+	// Two 2x2 frames: red, then blue, with the blue frame lasting longer and
+	// only covering the bottom row
+	red := image.NewPaletted(image.Rect(0, 0, 2, 2), palette.Plan9)
+	blue := image.NewPaletted(image.Rect(0, 1, 2, 2), palette.Plan9)
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			red.Set(x, y, color.RGBA{0xff, 0, 0, 0xff})
+		}
+		blue.Set(x, 1, color.RGBA{0, 0, 0xff, 0xff})
+	}
+	var b bytes.Buffer
+	err := gif.EncodeAll(&b, &gif.GIF{
+		Image: []*image.Paletted{red, blue},
+		Delay: []int{10, 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip, err := LoadGIF(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clip.Duration() != 400*time.Millisecond {
+		t.Fatalf("Unexpected clip duration %v", clip.Duration())
+	}
+
+	playbacks := NewImagePlaybacks(clip, 4, ScaleNone, true)
+	now := time.Unix(0, 0)
+	for _, p := range playbacks {
+		p.Start(now)
+	}
+	frameAt := func(idx int, at time.Duration) color.RGBA {
+		out, done := playbacks[idx].Frame(make([]color.RGBA, 2), now.Add(at))
+		if done {
+			t.Fatal("Looping playback completed")
+		}
+		return out[0]
+	}
+	// Universes 0 and 1 show the top row, which the second frame leaves red;
+	// 2 and 3 the bottom row
+	if c := frameAt(0, 200*time.Millisecond); c.R != 0xff || c.B != 0 {
+		t.Fatalf("Top row not red in second frame: %v", c)
+	}
+	if c := frameAt(3, 200*time.Millisecond); c.B != 0xff || c.R != 0 {
+		t.Fatalf("Bottom row not blue in second frame: %v", c)
+	}
+	// Loops back to the first frame
+	if c := frameAt(3, 450*time.Millisecond); c.R != 0xff {
+		t.Fatalf("Didn't loop: %v", c)
+	}
+}
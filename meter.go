@@ -0,0 +1,129 @@
+package animation
+
+// Bar-graph meter effect, for visualizing health, level and the like
+
+import (
+	"image/color"
+	"math"
+	"sync"
+	"time"
+)
+
+// Meter fills a universe in proportion to a value, 0-100%, like a bar graph.
+// The value can be changed at any time, with the meter animating smoothly to
+// the new value
+type Meter struct {
+	fill, empty color.RGBA
+	transition  time.Duration
+	segments    int     // Number of segments, or 0 for a continuous meter
+	from, to    float64 // Values the current transition runs between
+	target      float64 // Value most recently set
+	changeTime  time.Time
+	changed     bool // Has the value been set since the last frame?
+	sync.Mutex
+}
+
+// NewMeter creates a continuous Meter, initially at 0%. transition is the time
+// taken to animate from one value to another
+func NewMeter(fill, empty color.RGBA, transition time.Duration) *Meter {
+	return &Meter{fill: fill, empty: empty, transition: transition}
+}
+
+// NewSegmentedMeter creates a Meter divided into a number of equally-sized
+// segments, each of which is either lit or unlit
+func NewSegmentedMeter(fill, empty color.RGBA, segments int, transition time.Duration) *Meter {
+	m := NewMeter(fill, empty, transition)
+	m.segments = segments
+	return m
+}
+
+// SetValue sets the value, 0-100, for the meter to display. It may be called
+// while the meter is running
+func (m *Meter) SetValue(value float64) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.target = math.Max(0.0, math.Min(100.0, value))
+	m.changed = true
+}
+
+// Value gets the value most recently set
+func (m *Meter) Value() float64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.target
+}
+
+// Start sets the start time of the Meter effect. The meter starts at its
+// current value, with no transition
+func (m *Meter) Start(startTime time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.from, m.to = m.target, m.target
+	m.changeTime = startTime
+	m.changed = false
+}
+
+// Clone creates an unstarted copy of the meter, showing its current value. Values
+// set on one afterwards aren't seen by the other
+func (m *Meter) Clone() Animation {
+	m.Lock()
+	defer m.Unlock()
+
+	return &Meter{fill: m.fill, empty: m.empty, transition: m.transition, segments: m.segments, target: m.target}
+}
+
+// displayed gives the value shown at frameTime, partway through any transition
+func (m *Meter) displayed(frameTime time.Time) float64 {
+	if m.transition <= 0 {
+		return m.to
+	}
+	progress := float64(frameTime.Sub(m.changeTime)) / float64(m.transition)
+	if progress >= 1.0 {
+		return m.to
+	}
+	if progress < 0.0 {
+		progress = 0.0
+	}
+	// Ease in and out
+	progress = progress * progress * (3.0 - 2.0*progress)
+	return m.from + (m.to-m.from)*progress
+}
+
+// Frame creates a frame of the Meter effect. It never completes
+func (m *Meter) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.changed {
+		// Begin a transition from wherever we've got to
+		m.from = m.displayed(frameTime)
+		m.to = m.target
+		m.changeTime = frameTime
+		m.changed = false
+	}
+	value := m.displayed(frameTime)
+
+	n := len(buf)
+	if m.segments > 0 {
+		lit := int(value/100.0*float64(m.segments) + 0.5)
+		for idx := range buf {
+			if idx*m.segments/n < lit {
+				buf[idx] = m.fill
+			} else {
+				buf[idx] = m.empty
+			}
+		}
+		return buf, false
+	}
+
+	// Continuous: light whole pixels, with the boundary pixel partially lit
+	level := value / 100.0 * float64(n)
+	for idx := range buf {
+		coverage := math.Max(0.0, math.Min(1.0, level-float64(idx)))
+		buf[idx] = blendRGBA(m.empty, m.fill, coverage)
+	}
+	return buf, false
+}
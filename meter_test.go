@@ -0,0 +1,56 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(white, black, 100*time.Millisecond)
+	m.SetValue(50.0)
+	now := time.Unix(0, 0)
+	m.Start(now)
+	buf := make([]color.RGBA, 10)
+	out, _ := m.Frame(buf, now)
+	for idx, p := range out {
+		if (idx < 5 && p != white) || (idx >= 5 && p != black) {
+			t.Fatalf("Pixel %d wrong at 50%%: %v", idx, p)
+		}
+	}
+
+	// Animate to 100%
+	m.SetValue(150.0)
+	if m.Value() != 100.0 {
+		t.Fatalf("Value not clamped: %v", m.Value())
+	}
+	m.Frame(buf, now.Add(time.Second))
+	out, _ = m.Frame(buf, now.Add(time.Second+50*time.Millisecond))
+	if out[6] != white || out[8] != black {
+		t.Fatalf("Unexpected pixels midway through transition: %v", reds(out))
+	}
+	out, _ = m.Frame(buf, now.Add(time.Second+100*time.Millisecond))
+	for idx, p := range out {
+		if p != white {
+			t.Fatalf("Pixel %d not lit at 100%%: %v", idx, p)
+		}
+	}
+}
+
+func TestSegmentedMeter(t *testing.T) {
+	m := NewSegmentedMeter(white, black, 4, 0)
+	m.SetValue(60.0)
+	now := time.Unix(0, 0)
+	m.Start(now)
+	out, _ := m.Frame(make([]color.RGBA, 8), now)
+	checkReds(t, "segments", out, []uint8{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+}
+
+func TestMeterPartialPixel(t *testing.T) {
+	m := NewMeter(white, black, 0)
+	m.SetValue(25.0)
+	now := time.Unix(0, 0)
+	m.Start(now)
+	out, _ := m.Frame(make([]color.RGBA, 2), now)
+	checkReds(t, "partial", out, []uint8{0x80, 0})
+}
@@ -2,6 +2,7 @@ package animation
 
 import (
 	"encoding/json"
+	"math/rand"
 
 	"github.com/TeamNorCal/animation/model"
 )
@@ -47,6 +48,16 @@ const (
 	RES
 )
 
+func (f Faction) String() string {
+	switch f {
+	case ENL:
+		return "ENL"
+	case RES:
+		return "RES"
+	}
+	return "NEU"
+}
+
 // Universe defines a universe from the perspective of the animation engine.
 // It consists of an index in the array of returned frame data, and a size
 type Universe struct {
@@ -129,60 +140,16 @@ func (cb *animCircBuf) size() int {
 	return (cb.tail + bufLen - cb.head) % bufLen
 }
 
-type seqCircBuf struct {
-	buf  []*Sequence
-	head int
-	tail int
-}
-
-func newSeqCircBuf() seqCircBuf {
-	return seqCircBuf{
-		buf:  make([]*Sequence, 5),
-		head: 0,
-		tail: 0,
-	}
-}
-
-func (cb *seqCircBuf) enqueue(seq *Sequence) {
-	cb.buf[cb.tail] = seq
-	cb.tail = (cb.tail + 1) % len(cb.buf)
-}
-
-func (cb *seqCircBuf) dequeue() *Sequence {
-	if cb.head == cb.tail {
-		return nil
-	}
-	ret := cb.buf[cb.head]
-	cb.buf[cb.head] = nil
-	cb.head = (cb.head + 1) % len(cb.buf)
-	return ret
-}
-
-func (cb *seqCircBuf) clear() {
-	for cb.head != cb.tail {
-		cb.buf[cb.head] = nil
-		cb.head = (cb.head + 1) % len(cb.buf)
-	}
-}
-
-func (cb *seqCircBuf) peek() *Sequence {
-	if cb.head == cb.tail {
-		return nil
-	}
-	return cb.buf[cb.head]
-}
-
-func (cb *seqCircBuf) size() int {
-	bufLen := len(cb.buf)
-	return (cb.tail + bufLen - cb.head) % bufLen
-}
-
 // Portal encapsulates the animation status of the entire portal. This will probably be a singleton
 // object, but the fields are encapsulated into a struct to allow for something different
 type Portal struct {
 	currentStatus *PortalStatus       // The cached current status of the portal
 	sr            *SequenceRunner     // SequenceRunner for portal portion
-	seqBuf        seqCircBuf          // Queue of sequences to run on SequenceRunner
+	sched         *SequenceScheduler  // Schedules sequences to run on SequenceRunner
+	ownedSeq      *Sequence           // Cycle run while the portal is owned, kept to update its hold time
 	resonators    []animCircBuf       // Animations for resonators
 	frameBuf      []model.ChannelData // Frame buffers by universe
+	rng           *rand.Rand          // Source of randomness for portal animations
+	governor      *SafetyGovernor     // Photosensitivity limits applied to all output
+	clock         Clock               // Source of time for animations started by status updates
 }
@@ -0,0 +1,136 @@
+package animation
+
+// Nested sequences: a step which runs a whole sequence, so sequences can be
+// used as building blocks of larger ones
+
+import (
+	"image/color"
+	"sort"
+	"time"
+)
+
+// parentUniverse maps a universe of a step's sub-sequence onto the universe of
+// the sequence containing the step
+func (s *Step) parentUniverse(child uint) uint {
+	if parent, isPresent := s.UniverseMap[child]; isPresent {
+		return parent
+	}
+	return child + s.UniverseOffset
+}
+
+// universes lists the universes targeted by the sequence's steps, in order
+func (seq *Sequence) universes() []uint {
+	seen := make(map[uint]bool)
+	seq.collectUniverses(seen, make(map[*Sequence]bool), func(u uint) uint { return u })
+	ids := make([]uint, 0, len(seen))
+	for universeID := range seen {
+		ids = append(ids, universeID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// collectUniverses marks the universes targeted by the sequence's steps,
+// mapped to those of the outermost sequence. Sub-sequences which contain
+// themselves are only visited once
+func (seq *Sequence) collectUniverses(seen map[uint]bool, visiting map[*Sequence]bool, mapping func(uint) uint) {
+	if visiting[seq] {
+		return
+	}
+	visiting[seq] = true
+	for _, step := range seq.steps {
+		if step == nil {
+			continue
+		}
+		if step.SubSequence != nil {
+			s := step
+			step.SubSequence.collectUniverses(seen, visiting, func(u uint) uint { return mapping(s.parentUniverse(u)) })
+			continue
+		}
+		for _, universeID := range seq.targets(step) {
+			seen[mapping(universeID)] = true
+		}
+	}
+	visiting[seq] = false
+}
+
+// subSequenceRun is a run of a step's sub-sequence, on a runner of its own. It's
+// rendered by the first of its universes to get to it each frame
+type subSequenceRun struct {
+	runner     *SequenceRunner
+	renderedAt time.Time
+	done       bool
+}
+
+// subSequenceView shows one universe of a sub-sequence run, completing when
+// the whole sub-sequence does
+type subSequenceView struct {
+	run      *subSequenceRun
+	universe uint // Universe of the sub-sequence
+}
+
+func (v *subSequenceView) Start(startTime time.Time) {}
+
+func (v *subSequenceView) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	run := v.run
+	if !run.renderedAt.Equal(frameTime) && !run.done {
+		run.done = run.runner.ProcessFrame(frameTime)
+		run.renderedAt = frameTime
+	}
+	copy(buf, run.runner.UniverseData(v.universe))
+	return buf, run.done
+}
+
+// startSubSequence starts a run of a step's sub-sequence, with a view of each
+// of its universes queued on the corresponding universe of this runner
+func (sr *SequenceRunner) startSubSequence(act *activation, now time.Time) {
+	step := act.step
+	children := step.SubSequence.universes()
+	// The sub-sequence only gets the universes its steps use, sized to match
+	// those they're shown on
+	run := &subSequenceRun{runner: NewSequenceRunner(nil)}
+	for _, child := range children {
+		var size uint
+		if layers, isPresent := sr.activeByUniverse[step.parentUniverse(child)]; isPresent {
+			size = uint(len(layers[0].buf))
+		}
+		run.runner.addUniverse(child, size)
+	}
+	// It can't run itself, or a sequence it's inside of
+	run.runner.enclosing = map[*Sequence]bool{step.SubSequence: true}
+	for seq := range sr.enclosing {
+		run.runner.enclosing[seq] = true
+	}
+	// The sub-sequence sees the same variables, and makes reproducible choices
+	run.runner.vars = sr.vars
+	run.runner.seeds.Seed(sr.rng.Int63())
+	run.runner.InitSequence(step.SubSequence, now)
+	for _, child := range children {
+		universeID := step.parentUniverse(child)
+		layers, isPresent := sr.activeByUniverse[universeID]
+		if !isPresent {
+			layers = newLayerStack(0)
+		}
+		l := layers.get(step.Layer)
+		sr.setLayers(universeID, layers)
+		// The sub-sequence carries on from what the layer was showing, so effects
+		// such as fades start from the right place
+		copy(run.runner.activeByUniverse[child][0].buf, l.buf)
+		copy(run.runner.buffers[child], l.buf)
+		l.steps = append(l.steps, activeStep{act, &subSequenceView{run, child}, now})
+	}
+}
+
+// duration estimates how long the sequence takes to complete, looking up to
+// window ahead
+func (seq *Sequence) duration(window time.Duration) (d time.Duration, known bool) {
+	for _, entry := range seq.Timeline(window) {
+		if entry.Open {
+			return Forever, false
+		}
+		if entry.End > d {
+			d = entry.End
+		}
+	}
+	return d, true
+}
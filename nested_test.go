@@ -0,0 +1,153 @@
+package animation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubSequence(t *testing.T) {
+	ms := time.Millisecond
+	// A building block lighting universes 0 and 1 in turn
+	block := NewSequence().
+		AddInitialStep("first", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("second", &Step{UniverseID: 1, Effect: NewTimedSolid(white, 100*ms)})
+	block.steps["first"].ThenDoImmediately("second")
+
+	// Run it on universes 2 and 3, then on 0 and 3
+	seq := NewSequence().
+		AddInitialStep("a", &Step{SubSequence: block, UniverseOffset: 2}).
+		AddStep("b", &Step{SubSequence: block, UniverseMap: map[uint]uint{1: 3}})
+	seq.steps["a"].ThenDoImmediately("b")
+	if err := seq.Validate(make([]uint, 4)); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	if targets := seq.targets(seq.steps["b"]); !sameUniverses(targets, []uint{0, 3}) {
+		t.Fatalf("Unexpected targets for b: %v", targets)
+	}
+
+	sr := NewSequenceRunner([]uint{1, 1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	lit := func() (ids []uint) {
+		for u := uint(0); u < 4; u++ {
+			if sr.UniverseData(u)[0] == white {
+				ids = append(ids, u)
+			}
+		}
+		return ids
+	}
+	expected := map[time.Duration][]uint{
+		0:        {2},
+		100 * ms: {2},
+		150 * ms: {2, 3},
+		// a completes once its sub-sequence has, starting b, whose first step
+		// lights universe 0
+		300 * ms: {0, 2, 3},
+	}
+	done := false
+	for elapsed := time.Duration(0); elapsed <= time.Second && !done; elapsed += 10 * ms {
+		done = sr.ProcessFrame(start.Add(elapsed))
+		if e, isPresent := expected[elapsed]; isPresent {
+			if ids := lit(); !sameUniverses(ids, e) {
+				t.Fatalf("At %v: expected universes %v lit; got %v", elapsed, e, ids)
+			}
+		}
+	}
+	if !done {
+		t.Fatal("Expected sequence to complete once both sub-sequences had")
+	}
+
+	// The timeline knows how long sub-sequences take
+	for _, e := range seq.Timeline(time.Second) {
+		if e.Open {
+			t.Fatalf("Expected sub-sequence steps to complete in the timeline; got %+v", e)
+		}
+	}
+}
+
+func TestSubSequenceValidation(t *testing.T) {
+	bad := NewSequence().AddInitialStep("nothing", &Step{})
+	seq := NewSequence().AddInitialStep("nested", &Step{SubSequence: bad})
+	seq.AddStep("self", &Step{SubSequence: seq})
+	seq.steps["nested"].ThenDoImmediately("self")
+	err := seq.Validate(nil)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	msg := err.Error()
+	for _, expected := range []string{
+		`step "nested": sub-sequence: step "nothing": has no effect`,
+		`step "self": runs a sub-sequence containing this sequence`,
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Fatalf("Expected %s; got %v", expected, msg)
+		}
+	}
+}
+
+func TestSubSequenceRunningItself(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("again", &Step{UniverseOffset: 1})
+	seq.steps["again"].SubSequence = seq
+	seq.steps["a"].ThenDoImmediately("again")
+
+	// Each level runs on the next universe, stopping once it'd run itself again
+	// rather than recursing
+	sr := NewSequenceRunner([]uint{1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	done := false
+	for elapsed := time.Duration(0); elapsed <= time.Second && !done; elapsed += 10 * ms {
+		done = sr.ProcessFrame(start.Add(elapsed))
+	}
+	if !done {
+		t.Fatal("Expected sequence to complete")
+	}
+}
+
+func TestSubSequenceUniverses(t *testing.T) {
+	// A sub-sequence using a high universe ID only gets that universe
+	block := NewSequence().
+		AddInitialStep("far", &Step{UniverseID: 1000, Effect: NewTimedSolid(white, time.Second)})
+	seq := NewSequence().
+		AddInitialStep("a", &Step{SubSequence: block, UniverseMap: map[uint]uint{1000: 0}})
+
+	sr := NewSequenceRunner([]uint{1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	if sr.UniverseData(0)[0] != white {
+		t.Fatalf("Expected universe 0 lit by the sub-sequence; got %v", sr.UniverseData(0))
+	}
+	layers := sr.activeByUniverse[0]
+	view := layers[0].steps[0].effect.(*subSequenceView)
+	if n := len(view.run.runner.buffers); n != 1 {
+		t.Fatalf("Expected the sub-sequence to have 1 universe; got %d", n)
+	}
+}
+
+func TestParseNestedSequence(t *testing.T) {
+	def := `{
+	  "steps": [
+	    {"name": "pulse", "sequence": {
+	      "steps": [{"name": "flash", "universe": "towerLevel1Window1", "effect": "flash", "params": {"color": "#ffffff"}}],
+	      "initial": [{"step": "flash"}]
+	    }, "next": [{"step": "after"}]},
+	    {"name": "after", "universe": "towerLevel1Window2", "effect": "solid", "params": {"color": "#00ff00"}}
+	  ],
+	  "initial": [{"step": "pulse"}]
+	}`
+	seq, err := ParseSequence([]byte(def), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sub := seq.steps["pulse"].SubSequence; sub == nil || sub.steps["flash"] == nil {
+		t.Fatalf("Expected pulse to run the nested sequence")
+	}
+	if err = seq.Validate(make([]uint, numShaftWindows)); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package animation
+
+/*
+Randomized effects. These take an explicit random source (or seed) rather than
+using the global one, so that a given seed and sequence of frame times always
+produces the same output
+*/
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Sparkle lights a random selection of pixels, changing the selection at a
+// fixed interval. Unlit pixels are set to black
+type Sparkle struct {
+	color      color.RGBA
+	density    float64
+	interval   time.Duration
+	rng        *rand.Rand
+	lastChange time.Time
+	lit        []bool
+}
+
+// NewSparkle creates a Sparkle effect. density is the probability, 0.0-1.0, of
+// any given pixel being lit
+func NewSparkle(c color.RGBA, density float64, interval time.Duration, rng *rand.Rand) *Sparkle {
+	return &Sparkle{color: c, density: density, interval: interval, rng: rng}
+}
+
+// Start sets the start time of the Sparkle effect
+func (effect *Sparkle) Start(startTime time.Time) {
+	effect.lastChange = startTime
+	effect.lit = nil
+}
+
+// Clone creates an unstarted copy of the effect, with a random source of its
+// own seeded from this one's
+func (effect *Sparkle) Clone() Animation {
+	c := *effect
+	c.rng = forkRand(effect.rng)
+	c.lit = nil
+	return &c
+}
+
+// Frame creates a frame of the Sparkle effect. It never completes
+func (effect *Sparkle) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if len(effect.lit) != len(buf) || frameTime.Sub(effect.lastChange) >= effect.interval {
+		if len(effect.lit) != len(buf) {
+			effect.lit = make([]bool, len(buf))
+		} else {
+			effect.lastChange = frameTime
+		}
+		for idx := range effect.lit {
+			effect.lit[idx] = effect.rng.Float64() < effect.density
+		}
+	}
+	for idx := range buf {
+		if effect.lit[idx] {
+			buf[idx] = effect.color
+		} else {
+			buf[idx] = color.RGBA{0, 0, 0, 0xff}
+		}
+	}
+	return buf, false
+}
+
+// Twinkle has random pixels fade up to a color and back down again, against a
+// black background
+type Twinkle struct {
+	color     color.RGBA
+	rate      float64
+	duration  time.Duration
+	rng       *rand.Rand
+	lastFrame time.Time
+	started   []time.Time // Time each pixel's current twinkle started; zero if idle
+}
+
+// NewTwinkle creates a Twinkle effect. rate is the average number of times
+// per second each pixel begins to twinkle; duration is the length of a single
+// twinkle, fading in then out. Twinkles with no duration are over at once, so
+// never show
+func NewTwinkle(c color.RGBA, rate float64, duration time.Duration, rng *rand.Rand) *Twinkle {
+	return &Twinkle{color: c, rate: rate, duration: duration, rng: rng}
+}
+
+// Start sets the start time of the Twinkle effect
+func (effect *Twinkle) Start(startTime time.Time) {
+	effect.lastFrame = startTime
+	effect.started = nil
+}
+
+// Clone creates an unstarted copy of the effect, with a random source of its
+// own seeded from this one's
+func (effect *Twinkle) Clone() Animation {
+	c := *effect
+	c.rng = forkRand(effect.rng)
+	c.started = nil
+	return &c
+}
+
+// Frame creates a frame of the Twinkle effect. It never completes
+func (effect *Twinkle) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if len(effect.started) != len(buf) {
+		effect.started = make([]time.Time, len(buf))
+	}
+	// Probability of an idle pixel starting a twinkle since the last frame
+	chance := effect.rate * frameTime.Sub(effect.lastFrame).Seconds()
+	effect.lastFrame = frameTime
+	for idx := range buf {
+		if !effect.started[idx].IsZero() && frameTime.Sub(effect.started[idx]) > effect.duration {
+			effect.started[idx] = time.Time{}
+		}
+		if effect.started[idx].IsZero() && effect.rng.Float64() < chance {
+			effect.started[idx] = frameTime
+		}
+		brightness := 0.0
+		if !effect.started[idx].IsZero() && effect.duration > 0 {
+			phase := float64(frameTime.Sub(effect.started[idx])) / float64(effect.duration)
+			brightness = math.Sin(math.Pi * phase)
+		}
+		buf[idx] = scaleColor(effect.color, brightness)
+	}
+	return buf, false
+}
+
+// scaleColor scales the RGB components of a color by brightness, 0.0-1.0
+func scaleColor(c color.RGBA, brightness float64) color.RGBA {
+	return color.RGBA{
+		uint8(float64(c.R)*brightness + 0.5),
+		uint8(float64(c.G)*brightness + 0.5),
+		uint8(float64(c.B)*brightness + 0.5),
+		c.A,
+	}
+}
+
+// Noise is a smoothly varying pattern generated from Perlin noise, mapped to
+// colors through a gradient
+type Noise struct {
+	gradient  Gradient
+	scale     float64
+	speed     float64
+	perlin    *perlin
+	startTime time.Time
+}
+
+// NewNoise creates a Noise effect. scale is the size of the noise features:
+// the number of pixels over which the pattern typically changes. speed is the
+// rate of change over time, with 1.0 changing about once per second
+func NewNoise(gradient Gradient, scale, speed float64, seed int64) *Noise {
+	return &Noise{gradient: gradient, scale: scale, speed: speed, perlin: newPerlin(seed)}
+}
+
+// Start sets the start time of the Noise effect
+func (effect *Noise) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect, sharing its noise field
+func (effect *Noise) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the Noise effect. It never completes
+func (effect *Noise) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	y := frameTime.Sub(effect.startTime).Seconds() * effect.speed
+	scale := effect.scale
+	if scale <= 0 {
+		scale = 1.0
+	}
+	for idx := range buf {
+		n := effect.perlin.at(float64(idx)/scale, y)
+		buf[idx] = effect.gradient.At((n + 1.0) / 2.0)
+	}
+	return buf, false
+}
+
+// perlin generates 2D Perlin gradient noise
+type perlin struct {
+	perm [512]uint8
+}
+
+func newPerlin(seed int64) *perlin {
+	p := &perlin{}
+	rng := rand.New(rand.NewSource(seed))
+	for idx, v := range rng.Perm(256) {
+		p.perm[idx] = uint8(v)
+		p.perm[idx+256] = uint8(v)
+	}
+	return p
+}
+
+// at gives the noise value at (x, y), in the range -1.0 to 1.0
+func (p *perlin) at(x, y float64) float64 {
+	xf, yf := math.Floor(x), math.Floor(y)
+	xi, yi := int(xf)&0xff, int(yf)&0xff
+	x, y = x-xf, y-yf
+	u, v := fade(x), fade(y)
+
+	aa := p.perm[int(p.perm[xi])+yi]
+	ab := p.perm[int(p.perm[xi])+yi+1]
+	ba := p.perm[int(p.perm[xi+1])+yi]
+	bb := p.perm[int(p.perm[xi+1])+yi+1]
+
+	x1 := lerp(grad(aa, x, y), grad(ba, x-1, y), u)
+	x2 := lerp(grad(ab, x, y-1), grad(bb, x-1, y-1), u)
+	n := lerp(x1, x2, v)
+	// Scale the theoretical range of 2D Perlin noise up to +/-1
+	return math.Max(-1.0, math.Min(1.0, n*math.Sqrt2))
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + t*(b-a)
+}
+
+func grad(hash uint8, x, y float64) float64 {
+	switch hash & 0x7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	}
+	return -y
+}
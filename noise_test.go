@@ -0,0 +1,82 @@
+package animation
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// renderFrames renders frames of an effect at 10ms intervals, returning a copy
+// of each
+func renderFrames(effect Animation, size, count int) [][]color.RGBA {
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	frames := make([][]color.RGBA, count)
+	buf := make([]color.RGBA, size)
+	for idx := range frames {
+		out, _ := effect.Frame(buf, now.Add(time.Duration(idx)*10*time.Millisecond))
+		frames[idx] = append([]color.RGBA(nil), out...)
+	}
+	return frames
+}
+
+func framesEqual(a, b [][]color.RGBA) bool {
+	for idx := range a {
+		for p := range a[idx] {
+			if a[idx][p] != b[idx][p] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestRandomEffectsReproducible(t *testing.T) {
+	red := RGBAFromRGBHex(0xff0000)
+	makers := map[string]func(seed int64) Animation{
+		"sparkle": func(seed int64) Animation {
+			return NewSparkle(red, 0.3, 20*time.Millisecond, rand.New(rand.NewSource(seed)))
+		},
+		"twinkle": func(seed int64) Animation {
+			return NewTwinkle(red, 2.0, 100*time.Millisecond, rand.New(rand.NewSource(seed)))
+		},
+		"noise": func(seed int64) Animation {
+			return NewNoise(NewPaletteHexRGB(0x000000, 0xff0000).Gradient(), 5.0, 1.0, seed)
+		},
+	}
+	for name, maker := range makers {
+		a := renderFrames(maker(42), windowSize, 50)
+		b := renderFrames(maker(42), windowSize, 50)
+		if !framesEqual(a, b) {
+			t.Errorf("%s: same seed produced different output", name)
+		}
+		c := renderFrames(maker(43), windowSize, 50)
+		if framesEqual(a, c) {
+			t.Errorf("%s: different seeds produced identical output", name)
+		}
+	}
+}
+
+func TestTwinkleNoDuration(t *testing.T) {
+	red := RGBAFromRGBHex(0xff0000)
+	effect := NewTwinkle(red, 100.0, 0, rand.New(rand.NewSource(1)))
+	for idx, frame := range renderFrames(effect, windowSize, 20) {
+		for p, c := range frame {
+			if c != (color.RGBA{A: red.A}) {
+				t.Fatalf("Frame %d: expected pixel %d dark; got %v", idx, p, c)
+			}
+		}
+	}
+}
+
+func TestNoiseRange(t *testing.T) {
+	p := newPerlin(1)
+	for x := 0.0; x < 20.0; x += 0.37 {
+		for y := 0.0; y < 5.0; y += 0.29 {
+			if n := p.at(x, y); n < -1.0 || n > 1.0 {
+				t.Fatalf("Noise out of range at (%v, %v): %v", x, y, n)
+			}
+		}
+	}
+}
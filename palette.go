@@ -0,0 +1,263 @@
+package animation
+
+// Multi-color effects, driven by gradients and palettes
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+
+	colorful "github.com/lucasb-eyer/go-colorful"
+)
+
+// GradientStop is a color at a position, 0.0-1.0, along a gradient
+type GradientStop struct {
+	Position float64
+	Color    color.RGBA
+}
+
+// Gradient is a multi-stop color gradient. Stops are expected to be ordered by
+// position
+type Gradient []GradientStop
+
+// NewGradient creates a gradient with the provided colors spaced evenly along
+// it
+func NewGradient(colors ...color.RGBA) Gradient {
+	g := make(Gradient, len(colors))
+	for idx, c := range colors {
+		pos := 0.0
+		if len(colors) > 1 {
+			pos = float64(idx) / float64(len(colors)-1)
+		}
+		g[idx] = GradientStop{pos, c}
+	}
+	return g
+}
+
+// At returns the color of the gradient at the given position. Positions
+// outside of the stops take the color of the nearest stop
+func (g Gradient) At(pos float64) color.RGBA {
+	if len(g) == 0 {
+		return color.RGBA{0, 0, 0, 0xff}
+	}
+	if pos <= g[0].Position {
+		return g[0].Color
+	}
+	for idx := 1; idx < len(g); idx++ {
+		if pos <= g[idx].Position {
+			prev, next := g[idx-1], g[idx]
+			span := next.Position - prev.Position
+			if span <= 0 {
+				return next.Color
+			}
+			c := rgbaToColorful(prev.Color).BlendRgb(rgbaToColorful(next.Color), (pos-prev.Position)/span)
+			return colorfulToRGBA(c.Clamped())
+		}
+	}
+	return g[len(g)-1].Color
+}
+
+// rgbaToColorful converts an opaque color.RGBA to a colorful.Color. Unlike
+// colorful.MakeColor it avoids boxing the color in an interface, so is cheap
+// enough for per-pixel use
+func rgbaToColorful(c color.RGBA) colorful.Color {
+	return colorful.Color{R: float64(c.R) / 255.0, G: float64(c.G) / 255.0, B: float64(c.B) / 255.0}
+}
+
+// Palette is an ordered set of colors
+type Palette []color.RGBA
+
+// NewPaletteHexRGB creates a palette from hex-encoded 24-bit RGB colors
+func NewPaletteHexRGB(hexColors ...uint32) Palette {
+	p := make(Palette, len(hexColors))
+	for idx, h := range hexColors {
+		p[idx] = RGBAFromRGBHex(h)
+	}
+	return p
+}
+
+// Gradient creates a gradient with the palette's colors spaced evenly along it
+func (p Palette) Gradient() Gradient {
+	return NewGradient(p...)
+}
+
+// Palettes contains the named palettes available to effects
+var Palettes = map[string]Palette{
+	"enl":             NewPaletteHexRGB(0x00ff00, 0x00cc33, 0x009900, 0x33ff66, 0x006600),
+	"res":             NewPaletteHexRGB(0x0000ff, 0x0066ff, 0x00ccff, 0x3333cc, 0x000099),
+	"neutral":         NewPaletteHexRGB(0xaaaaaa, 0xffffff, 0x777777, 0xdddddd, 0x444444),
+	"resonatorLevels": NewPaletteHexRGB(resonatorLevelColors...),
+	"fire":            NewPaletteHexRGB(0x000000, 0x990000, 0xff3300, 0xffaa00, 0xffffcc),
+}
+
+// LookupPalette finds a palette by name
+func LookupPalette(name string) (Palette, error) {
+	p, ok := Palettes[name]
+	if !ok {
+		return nil, fmt.Errorf("\"%s\" is not a known palette", name)
+	}
+	return p, nil
+}
+
+// fraction returns the fractional part of f, in the range [0.0, 1.0)
+func fraction(f float64) float64 {
+	return f - math.Floor(f)
+}
+
+// StaticGradient spreads a gradient across the universe, unchanging
+type StaticGradient struct {
+	gradient Gradient
+}
+
+// NewStaticGradient creates a StaticGradient effect
+func NewStaticGradient(gradient Gradient) *StaticGradient {
+	return &StaticGradient{gradient: gradient}
+}
+
+// Start the StaticGradient effect - NOP
+func (effect *StaticGradient) Start(startTime time.Time) {
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *StaticGradient) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the StaticGradient effect. It never completes
+func (effect *StaticGradient) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	for idx := range buf {
+		pos := 0.0
+		if len(buf) > 1 {
+			pos = float64(idx) / float64(len(buf)-1)
+		}
+		buf[idx] = effect.gradient.At(pos)
+	}
+	return buf, false
+}
+
+// ScrollingGradient spreads a gradient across the universe and scrolls it
+// along, wrapping around. Gradients whose first and last colors match scroll
+// seamlessly
+type ScrollingGradient struct {
+	gradient  Gradient
+	period    time.Duration
+	startTime time.Time
+}
+
+// NewScrollingGradient creates a ScrollingGradient effect. period is the time
+// taken to scroll the full length of the universe; a negative period scrolls
+// in the opposite direction
+func NewScrollingGradient(gradient Gradient, period time.Duration) *ScrollingGradient {
+	return &ScrollingGradient{gradient: gradient, period: period}
+}
+
+// Start sets the start time of the ScrollingGradient effect
+func (effect *ScrollingGradient) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *ScrollingGradient) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the ScrollingGradient effect. It never completes
+func (effect *ScrollingGradient) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	offset := 0.0
+	if effect.period != 0 {
+		offset = float64(frameTime.Sub(effect.startTime)) / float64(effect.period)
+	}
+	for idx := range buf {
+		buf[idx] = effect.gradient.At(fraction(float64(idx)/float64(len(buf)) - offset))
+	}
+	return buf, false
+}
+
+// Rainbow cycles through the hues of the rainbow
+type Rainbow struct {
+	period    time.Duration
+	spread    float64
+	startTime time.Time
+}
+
+// NewRainbow creates a Rainbow effect. period is the time for a full cycle of
+// hues. spread is the fraction of the hue circle spread across the universe at
+// any time: 0.0 gives a solid color, 1.0 a full rainbow
+func NewRainbow(period time.Duration, spread float64) *Rainbow {
+	return &Rainbow{period: period, spread: spread}
+}
+
+// Start sets the start time of the Rainbow effect
+func (effect *Rainbow) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *Rainbow) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the Rainbow effect. It never completes
+func (effect *Rainbow) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	phase := 0.0
+	if effect.period != 0 {
+		phase = float64(frameTime.Sub(effect.startTime)) / float64(effect.period)
+	}
+	for idx := range buf {
+		hue := fraction(phase+effect.spread*float64(idx)/float64(len(buf))) * 360.0
+		buf[idx] = colorfulToRGBA(colorful.Hsv(hue, 1.0, 1.0).Clamped())
+	}
+	return buf, false
+}
+
+// PaletteIndex colors each pixel by looking up a palette entry. The pattern
+// of indices is repeated across the universe, and can optionally be shifted
+// through the palette over time
+type PaletteIndex struct {
+	palette   Palette
+	indices   []int
+	shift     time.Duration
+	startTime time.Time
+}
+
+// NewPaletteIndex creates a PaletteIndex effect. indices gives the palette
+// index for successive pixels. If shift is non-zero, every index is advanced
+// by one each time that period passes
+func NewPaletteIndex(palette Palette, indices []int, shift time.Duration) *PaletteIndex {
+	return &PaletteIndex{palette: palette, indices: indices, shift: shift}
+}
+
+// Start sets the start time of the PaletteIndex effect
+func (effect *PaletteIndex) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *PaletteIndex) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the PaletteIndex effect. It never completes
+func (effect *PaletteIndex) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if len(effect.palette) == 0 || len(effect.indices) == 0 {
+		return buf, false
+	}
+	offset := 0
+	if effect.shift > 0 {
+		offset = int(frameTime.Sub(effect.startTime) / effect.shift)
+	}
+	n := len(effect.palette)
+	for idx := range buf {
+		pIdx := (effect.indices[idx%len(effect.indices)] + offset) % n
+		if pIdx < 0 {
+			pIdx += n
+		}
+		buf[idx] = effect.palette[pIdx]
+	}
+	return buf, false
+}
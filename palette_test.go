@@ -0,0 +1,89 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestGradientAt(t *testing.T) {
+	g := NewGradient(RGBAFromRGBHex(0x000000), RGBAFromRGBHex(0xff0000), RGBAFromRGBHex(0xffffff))
+	for _, c := range []struct {
+		pos      float64
+		expected color.RGBA
+	}{
+		{-1.0, RGBAFromRGBHex(0x000000)},
+		{0.25, RGBAFromRGBHex(0x800000)},
+		{0.5, RGBAFromRGBHex(0xff0000)},
+		{0.75, RGBAFromRGBHex(0xff8080)},
+		{2.0, RGBAFromRGBHex(0xffffff)},
+	} {
+		if got := g.At(c.pos); got != c.expected {
+			t.Errorf("At %v expected %v, got %v", c.pos, c.expected, got)
+		}
+	}
+}
+
+func TestScrollingGradient(t *testing.T) {
+	g := NewPaletteHexRGB(0x000000, 0xffffff).Gradient()
+	effect := NewScrollingGradient(g, 4*time.Second)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 4)
+	first, _ := effect.Frame(buf, now)
+	firstReds := reds(first)
+	shifted, _ := effect.Frame(buf, now.Add(time.Second))
+	// After a quarter period, each pixel should show what its left-hand
+	// neighbor did
+	for idx := 1; idx < len(buf); idx++ {
+		if shifted[idx].R != firstReds[idx-1] {
+			t.Fatalf("Gradient didn't scroll: %v then %v", firstReds, reds(shifted))
+		}
+	}
+}
+
+func TestRainbow(t *testing.T) {
+	effect := NewRainbow(3*time.Second, 0.0)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 2)
+	for _, c := range []struct {
+		at       time.Duration
+		expected color.RGBA
+	}{
+		{0, RGBAFromRGBHex(0xff0000)},
+		{time.Second, RGBAFromRGBHex(0x00ff00)},
+		{2 * time.Second, RGBAFromRGBHex(0x0000ff)},
+	} {
+		out, _ := effect.Frame(buf, now.Add(c.at))
+		if out[0] != c.expected || out[1] != c.expected {
+			t.Errorf("At %v expected %v, got %v", c.at, c.expected, out)
+		}
+	}
+}
+
+func TestPaletteIndex(t *testing.T) {
+	p, err := LookupPalette("resonatorLevels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p[8] != RGBAFromRGBHex(resonatorLevelColors[8]) {
+		t.Fatalf("Unexpected L8 color %v", p[8])
+	}
+	if _, err := LookupPalette("nonexistent"); err == nil {
+		t.Fatal("No error for unknown palette")
+	}
+
+	effect := NewPaletteIndex(p, []int{1, 2}, time.Second)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 3)
+	out, _ := effect.Frame(buf, now)
+	if out[0] != p[1] || out[1] != p[2] || out[2] != p[1] {
+		t.Fatalf("Unexpected colors %v", out)
+	}
+	out, _ = effect.Frame(buf, now.Add(time.Second))
+	if out[0] != p[2] || out[1] != p[3] {
+		t.Fatalf("Unexpected colors after shift %v", out)
+	}
+}
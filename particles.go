@@ -0,0 +1,223 @@
+package animation
+
+// A simple 1D particle system
+
+import (
+	"image/color"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// The particle simulation advances in steps of this size, independent of
+	// the frame rate
+	particleTimestep = 10 * time.Millisecond
+	// Limit on simulation steps performed in a single frame
+	particleMaxCatchUp = 100
+	// Limit on live particles in a system; further spawns are dropped
+	maxParticles = 512
+)
+
+// Emitter describes how particles are spawned into a ParticleSystem, and how
+// they look and move once spawned. Positions are in pixels along the universe;
+// velocities in pixels per second
+type Emitter struct {
+	Position       float64       // Where particles are spawned
+	PositionSpread float64       // Random variation in spawn position, +/-
+	Velocity       float64       // Initial velocity
+	VelocitySpread float64       // Random variation in initial velocity, +/-
+	Acceleration   float64       // Change in velocity per second
+	Lifetime       time.Duration // How long particles live
+	LifetimeSpread time.Duration // Random variation in lifetime, +/-
+	Rate           float64       // Particles per second emitted continuously; 0 for none
+	Burst          int           // Number of particles emitted at once when the system starts
+	Colors         Gradient      // Color over the particle's life, from birth (0.0) to death (1.0)
+	Fade           bool          // Fade particles out towards the end of their lives?
+}
+
+type particle struct {
+	emitter  *Emitter
+	pos, vel float64
+	age      time.Duration
+	life     time.Duration
+}
+
+type pendingBurst struct {
+	emitter *Emitter
+	count   int
+}
+
+// ParticleSystem is an effect rendering particles spawned by a set of
+// emitters. Particles are added together where they overlap, and onto the
+// contents of the buffer when the system starts, e.g. whatever the universe was
+// showing. The simulation runs with a fixed timestep, so looks the same
+// whatever the frame rate
+type ParticleSystem struct {
+	emitters   []*Emitter
+	rng        *rand.Rand
+	particles  []particle
+	owed       []float64 // Fractional particles owed to each emitter by continuous emission
+	bursts     []pendingBurst
+	lastStep   time.Time
+	background []color.RGBA // Buffer contents at the first frame, which particles are added onto
+	sync.Mutex
+}
+
+// NewParticleSystem creates a ParticleSystem with the given emitters. If no
+// emitter emits continuously, the system completes once the particles from its
+// bursts have all died
+func NewParticleSystem(rng *rand.Rand, emitters ...*Emitter) *ParticleSystem {
+	return &ParticleSystem{
+		emitters:  emitters,
+		rng:       rng,
+		particles: make([]particle, 0, 64),
+		owed:      make([]float64, len(emitters)),
+	}
+}
+
+// Burst emits count particles from emitter at the next simulation step. It may
+// be called while the system is running
+func (ps *ParticleSystem) Burst(emitter *Emitter, count int) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.bursts = append(ps.bursts, pendingBurst{emitter, count})
+}
+
+// Start starts the particle system, clearing any particles and firing each
+// emitter's initial burst
+func (ps *ParticleSystem) Start(startTime time.Time) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.lastStep = startTime
+	ps.background = nil
+	ps.particles = ps.particles[:0]
+	ps.bursts = ps.bursts[:0]
+	for idx, e := range ps.emitters {
+		ps.owed[idx] = 0.0
+		if e.Burst > 0 {
+			ps.bursts = append(ps.bursts, pendingBurst{e, e.Burst})
+		}
+	}
+}
+
+// Clone creates an unstarted copy of the system, sharing its emitters, with a
+// random source of its own seeded from this one's. Bursts requested of this
+// system aren't emitted by the copy
+func (ps *ParticleSystem) Clone() Animation {
+	return NewParticleSystem(forkRand(ps.rng), ps.emitters...)
+}
+
+// Frame creates a frame of the particle system
+func (ps *ParticleSystem) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	for steps := fixedSteps(&ps.lastStep, frameTime, particleTimestep, particleMaxCatchUp); steps > 0; steps-- {
+		ps.step(len(buf))
+	}
+
+	if len(ps.background) != len(buf) {
+		ps.background = append([]color.RGBA(nil), buf...)
+	}
+	copy(buf, ps.background)
+	for _, p := range ps.particles {
+		ps.render(buf, &p)
+	}
+
+	return buf, ps.finished()
+}
+
+// finished reports whether the system has nothing more to show
+func (ps *ParticleSystem) finished() bool {
+	if len(ps.particles) > 0 || len(ps.bursts) > 0 {
+		return false
+	}
+	for _, e := range ps.emitters {
+		if e.Rate > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// step advances the simulation by a single timestep, for a universe of size n
+func (ps *ParticleSystem) step(n int) {
+	dt := particleTimestep.Seconds()
+
+	// Spawn new particles
+	for _, b := range ps.bursts {
+		for i := 0; i < b.count; i++ {
+			ps.spawn(b.emitter)
+		}
+	}
+	ps.bursts = ps.bursts[:0]
+	for idx, e := range ps.emitters {
+		ps.owed[idx] += e.Rate * dt
+		for ps.owed[idx] >= 1.0 {
+			ps.owed[idx]--
+			ps.spawn(e)
+		}
+	}
+
+	// Move particles, dropping those that have died or left the universe
+	live := ps.particles[:0]
+	for _, p := range ps.particles {
+		p.age += particleTimestep
+		p.vel += p.emitter.Acceleration * dt
+		p.pos += p.vel * dt
+		if p.age < p.life && p.pos > -1.0 && p.pos < float64(n) {
+			live = append(live, p)
+		}
+	}
+	ps.particles = live
+}
+
+// spread gives a random value in the range +/- amount
+func (ps *ParticleSystem) spread(amount float64) float64 {
+	return (ps.rng.Float64()*2.0 - 1.0) * amount
+}
+
+func (ps *ParticleSystem) spawn(e *Emitter) {
+	if len(ps.particles) >= maxParticles {
+		return
+	}
+	ps.particles = append(ps.particles, particle{
+		emitter: e,
+		pos:     e.Position + ps.spread(e.PositionSpread),
+		vel:     e.Velocity + ps.spread(e.VelocitySpread),
+		life:    e.Lifetime + time.Duration(ps.spread(float64(e.LifetimeSpread))),
+	})
+}
+
+// render adds a particle into the buffer. Particles between pixels are split
+// across the two, in proportion to their distance from each
+func (ps *ParticleSystem) render(buf []color.RGBA, p *particle) {
+	life := 0.0
+	if p.life > 0 {
+		life = float64(p.age) / float64(p.life)
+	}
+	c := p.emitter.Colors.At(life)
+	if p.emitter.Fade {
+		c = scaleColor(c, 1.0-life)
+	}
+	lower := int(p.pos+1.0) - 1 // Floor, for positions down to -1
+	frac := p.pos - float64(lower)
+	addPixel(buf, lower, scaleColor(c, 1.0-frac))
+	addPixel(buf, lower+1, scaleColor(c, frac))
+}
+
+// addPixel adds a color to a pixel, saturating, if the pixel is in the buffer
+func addPixel(buf []color.RGBA, idx int, c color.RGBA) {
+	if idx < 0 || idx >= len(buf) {
+		return
+	}
+	buf[idx] = color.RGBA{
+		blendChannel(buf[idx].R, c.R, BlendAdd),
+		blendChannel(buf[idx].G, c.G, BlendAdd),
+		blendChannel(buf[idx].B, c.B, BlendAdd),
+		0xff,
+	}
+}
@@ -0,0 +1,99 @@
+package animation
+
+import (
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParticleBurst(t *testing.T) {
+	e := &Emitter{
+		Position: 0.0,
+		Velocity: 10.0,
+		Lifetime: 500 * time.Millisecond,
+		Burst:    1,
+		Colors:   NewGradient(white),
+	}
+	ps := NewParticleSystem(rand.New(rand.NewSource(1)), e)
+	now := time.Unix(0, 0)
+	ps.Start(now)
+	buf := make([]color.RGBA, windowSize)
+
+	// After 200ms, the particle should have moved 2 pixels
+	out, done := ps.Frame(buf, now.Add(200*time.Millisecond))
+	if done {
+		t.Fatal("Done while particle alive")
+	}
+	if out[2] != white || out[1].R != 0 || out[3].R != 0 {
+		t.Fatalf("Particle not where expected: %v", reds(out))
+	}
+
+	if _, done = ps.Frame(buf, now.Add(time.Second)); !done {
+		t.Fatal("Not done after particle died")
+	}
+}
+
+func TestParticlesAddToBuffer(t *testing.T) {
+	dim := color.RGBA{0x20, 0, 0, 0xff}
+	ps := NewParticleSystem(rand.New(rand.NewSource(1)), &Emitter{
+		Velocity: 10.0,
+		Lifetime: 500 * time.Millisecond,
+		Burst:    1,
+		Colors:   NewGradient(color.RGBA{0, 0, 0x80, 0xff}),
+	})
+	now := time.Unix(0, 0)
+	ps.Start(now)
+	buf := make([]color.RGBA, windowSize)
+	for idx := range buf {
+		buf[idx] = dim
+	}
+
+	// The particle is added onto what the buffer showed when the system started,
+	// without leaving a trail as the buffer is reused
+	for _, e := range []struct {
+		at  time.Duration
+		pos int
+	}{{200 * time.Millisecond, 2}, {300 * time.Millisecond, 3}} {
+		out, _ := ps.Frame(buf, now.Add(e.at))
+		for idx, c := range out {
+			expected := dim
+			if idx == e.pos {
+				expected = color.RGBA{0x20, 0, 0x80, 0xff}
+			}
+			if c != expected {
+				t.Fatalf("At %v: pixel %d is %v; expected %v", e.at, idx, c, expected)
+			}
+		}
+	}
+}
+
+func TestParticlesFrameRateIndependent(t *testing.T) {
+	makeSystem := func() *ParticleSystem {
+		return NewParticleSystem(rand.New(rand.NewSource(7)), &Emitter{
+			Velocity:       20.0,
+			VelocitySpread: 5.0,
+			Acceleration:   5.0,
+			Lifetime:       time.Second,
+			Rate:           10.0,
+			Colors:         Palettes["enl"].Gradient(),
+			Fade:           true,
+		})
+	}
+	now := time.Unix(0, 0)
+	fast, slow := makeSystem(), makeSystem()
+	fast.Start(now)
+	slow.Start(now)
+	fastBuf, slowBuf := make([]color.RGBA, windowSize), make([]color.RGBA, windowSize)
+	for tick := 1; tick <= 100; tick++ {
+		fast.Frame(fastBuf, now.Add(time.Duration(tick)*10*time.Millisecond))
+		if tick%5 == 0 {
+			slow.Frame(slowBuf, now.Add(time.Duration(tick)*10*time.Millisecond))
+		}
+	}
+	for idx := range fastBuf {
+		if fastBuf[idx] != slowBuf[idx] {
+			t.Fatalf("Output differs with frame rate at pixel %d: %v vs %v", idx, fastBuf[idx], slowBuf[idx])
+		}
+	}
+}
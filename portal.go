@@ -26,6 +26,8 @@ const (
 	resoDimRatio = 0.7
 	// Length of reso pulse
 	resoPulseDuration = 3 * time.Second
+	// Maximum number of sequences waiting to run on the tower
+	maxQueuedSeqs = 4
 )
 
 // resoPositionToIndex maps a resonator position string (from Techthulu perspective)
@@ -82,8 +84,15 @@ func init() {
 	}
 }
 
-// NewPortal creates a new portal structure
+// NewPortal creates a new portal structure, running on the system clock
 func NewPortal() *Portal {
+	return NewPortalWithClock(SystemClock{})
+}
+
+// NewPortalWithClock creates a new portal structure, using clock as the source
+// of time for starting animations in response to status updates. Frame times
+// passed to GetFrame should come from the same clock
+func NewPortalWithClock(clock Clock) *Portal {
 	sizes := make([]uint, numShaftWindows)
 	for idx := range sizes {
 		sizes[idx] = windowSize
@@ -96,15 +105,45 @@ func NewPortal() *Portal {
 	for idx := 0; idx < numResos; idx++ {
 		resoBufs = append(resoBufs, newAnimCircBuf())
 	}
+	sr := NewSequenceRunner(sizes)
+	sr.SetClock(clock)
+	sr.Seed(clock.Now().UnixNano())
 	return &Portal{
 		currentStatus: &PortalStatus{NEU, 0.0, 0.0, make([]ResonatorStatus, numResos)},
-		sr:            NewSequenceRunner(sizes),
-		seqBuf:        newSeqCircBuf(),
+		sr:            sr,
+		sched:         NewSequenceScheduler(sr, maxQueuedSeqs, OverflowDropLowest),
 		resonators:    resoBufs,
 		frameBuf:      frameBuf,
+		rng:           rand.New(rand.NewSource(clock.Now().UnixNano())),
+		clock:         clock,
+		governor:      NewSafetyGovernor(),
 	}
 }
 
+// Clock gets the clock the portal uses
+func (p *Portal) Clock() Clock {
+	return p.clock
+}
+
+// SafetyGovernor gets the governor limiting flashing in the portal's output,
+// allowing its limits to be adjusted and its interventions inspected
+func (p *Portal) SafetyGovernor() *SafetyGovernor {
+	return p.governor
+}
+
+// Scheduler gets the scheduler of sequences on the tower, allowing what's
+// running and queued to be inspected
+func (p *Portal) Scheduler() *SequenceScheduler {
+	return p.sched
+}
+
+// Seed reseeds the random source used for randomized portal animations, making
+// them reproducible
+func (p *Portal) Seed(seed int64) {
+	p.rng.Seed(seed)
+	p.sr.Seed(seed)
+}
+
 func externalStatusToInternal(external *ingressModel.Status) (status *PortalStatus) {
 	status = &PortalStatus{
 		Faction:    NEU,
@@ -162,6 +201,10 @@ func (p *Portal) UpdateFromCanonicalStatus(status *ingressModel.Status) {
 // UpdateStatus updates the status of the portal from an animation perspective
 func (p *Portal) UpdateStatus(status *PortalStatus) {
 	newStatus := status.deepCopy()
+	// Made available to sequences' conditions
+	p.sr.SetVar("faction", newStatus.Faction.String())
+	p.sr.SetVar("level", newStatus.Level)
+	p.sr.SetVar("health", newStatus.Health)
 	if p.currentStatus.Faction != newStatus.Faction || p.currentStatus.Level != newStatus.Level {
 		p.updatePortal(status)
 	}
@@ -185,7 +228,7 @@ func (p *Portal) GetFrame(frameTime time.Time) []model.ChannelData {
 	for idx := 0; idx < numResos; idx++ {
 		p.getResoFrame(idx, frameTime)
 	}
-	seqDone := p.sr.ProcessFrame(frameTime)
+	p.sched.ProcessFrame(frameTime)
 	for idx := 0; idx < numShaftWindows; idx++ {
 		p.frameBuf[numResos+idx].Data = p.sr.UniverseData(uint(idx))
 		// Scale owned portal's brightness by health, to within the top half of the brightness range
@@ -193,45 +236,51 @@ func (p *Portal) GetFrame(frameTime time.Time) []model.ChannelData {
 			applyBrightness(p.frameBuf[numResos+idx].Data, p.currentStatus.Health/200.0+0.5)
 		}
 	}
-	if seqDone {
-		if nextSeq := p.seqBuf.dequeue(); nextSeq != nil {
-			p.sr.InitSequence(nextSeq, frameTime)
-		}
-	}
+	p.governor.Apply(p.frameBuf, frameTime)
 	return p.frameBuf
 }
 
 func createFadePulseSeq(c color.Color, pulseDuration time.Duration) *Sequence {
-	seq := NewSequence()
-	for uniID := 0; uniID < numShaftWindows; uniID++ {
-		idStr := strconv.Itoa(uniID)
-
-		fadeOut := &Step{
-			UniverseID: uint(uniID),
-			Effect:     NewInterpolateToHexRGB(0x000000, time.Second),
-		}
-		seq.AddInitialStep("fadeOut"+idStr, fadeOut)
+	seq := NewSequence().AddGroup("windows", shaftWindows()...)
+	// Each window fades out from its own current color, so needs its own effect
+	fadeOut := &Step{
+		Group:     "windows",
+		Instances: IndependentInstances,
+		Effect:    NewInterpolateToHexRGB(0x000000, time.Second),
+	}
+	seq.AddInitialStep("fadeOut", fadeOut)
 
-		pulse := &Step{
-			UniverseID: uint(uniID),
-			Effect:     NewPulse(RGBAFromRGBHex(0x000000), c, pulseDuration, true),
-		}
-		seq.AddStep("pulse"+idStr, pulse)
-		fadeOut.ThenDoImmediately("pulse" + idStr)
+	pulse := &Step{
+		Group:  "windows",
+		Effect: NewPulse(RGBAFromRGBHex(0x000000), c, pulseDuration, true),
 	}
+	seq.AddStep("pulse", pulse)
+	fadeOut.ThenDoImmediately("pulse")
 	return seq
 }
 
-func (p *Portal) createOwnedPortalSeq(newStatus *PortalStatus) {
-	var c uint32
-	switch newStatus.Faction {
-	case NEU:
-		c = 0xffffff
+// shaftWindows lists the universe IDs of the tower windows
+func shaftWindows() []uint {
+	ids := make([]uint, numShaftWindows)
+	for idx := range ids {
+		ids[idx] = uint(idx)
+	}
+	return ids
+}
+
+// factionColor gets the color representing a faction
+func factionColor(f Faction) uint32 {
+	switch f {
 	case ENL:
-		c = 0x00ff00
+		return 0x00ff00
 	case RES:
-		c = 0x0000ff
+		return 0x0000ff
 	}
+	return 0xffffff
+}
+
+func (p *Portal) createOwnedPortalSeq(newStatus *PortalStatus) {
+	c := factionColor(newStatus.Faction)
 	stepMap := make(map[string]*Step)
 	for uniID := 0; uniID < numShaftWindows; uniID++ {
 		createWindowFadeInOut(stepMap, uniID, c, time.Duration(125.0*newStatus.Level)*time.Millisecond)
@@ -253,10 +302,13 @@ func (p *Portal) createOwnedPortalSeq(newStatus *PortalStatus) {
 	// Add the initial operation to kick it off - two cycles at once
 	seq.AddInitialOperation(Operation{StepName: "in0"})
 	seq.AddInitialOperation(Operation{StepName: "in1"})
-	p.seqBuf.clear() // Clear any still-pending sequences from before
-	p.seqBuf.enqueue(seq)
+	// The take-over pulse replaces anything still pending from before, then the
+	// cycle follows it
 	takeOverPulse := createFadePulseSeq(RGBAFromRGBHex(c), 1500*time.Millisecond)
-	p.sr.InitSequence(takeOverPulse, time.Now())
+	now := p.clock.Now()
+	p.sched.Submit(SequenceRequest{Name: "takeOver", Sequence: takeOverPulse, Policy: PolicyPreempt}, now)
+	p.sched.Submit(SequenceRequest{Name: "owned", Sequence: seq, Policy: PolicyQueue}, now)
+	p.ownedSeq = seq
 }
 
 func (p *Portal) createNeutralPortalSeq(newStatus *PortalStatus) {
@@ -289,7 +341,7 @@ func (p *Portal) createNeutralPortalSeq(newStatus *PortalStatus) {
 			Effect:     NewInterpolateToHexRGB(0xaaaaaa, time.Second),
 		}
 		seq.AddStep("fadeIn"+idStr, fadeIn)
-		pulseOut.ThenDo("fadeIn"+idStr, time.Duration(rand.Intn(3000))*time.Millisecond)
+		pulseOut.ThenDo("fadeIn"+idStr, time.Duration(p.rng.Intn(3000))*time.Millisecond)
 
 		solid := &Step{
 			UniverseID: uint(uniID),
@@ -298,8 +350,7 @@ func (p *Portal) createNeutralPortalSeq(newStatus *PortalStatus) {
 		seq.AddStep("solid"+idStr, solid)
 		fadeIn.ThenDoImmediately("solid" + idStr)
 	}
-	p.seqBuf.clear()
-	p.sr.InitSequence(seq, time.Now())
+	p.sched.Submit(SequenceRequest{Name: "neutral", Sequence: seq, Policy: PolicyPreempt}, p.clock.Now())
 }
 
 func (p *Portal) updatePortal(newStatus *PortalStatus) {
@@ -312,7 +363,7 @@ func (p *Portal) updatePortal(newStatus *PortalStatus) {
 		}
 	} else if p.currentStatus.Level != newStatus.Level {
 		if newStatus.Faction == ENL || newStatus.Faction == RES {
-			updateHoldTime(&p.sr.currSeq, time.Duration(125.0*newStatus.Level)*time.Millisecond)
+			p.updateHoldTime(factionColor(newStatus.Faction), time.Duration(125.0*newStatus.Level)*time.Millisecond)
 		}
 	}
 }
@@ -336,11 +387,14 @@ func createWindowFadeInOut(stepMap map[string]*Step, uniID int, color uint32, ho
 	stepMap["out"+idStr] = out
 }
 
-func updateHoldTime(seq *Sequence, holdTime time.Duration) {
+// updateHoldTime changes how long each window of the owned portal cycle holds
+// its color. Windows already holding carry on for the time they started with
+func (p *Portal) updateHoldTime(color uint32, holdTime time.Duration) {
+	if p.ownedSeq == nil {
+		return
+	}
 	for uniID := 0; uniID < numShaftWindows; uniID++ {
-		if step := seq.steps["solid"+strconv.Itoa(uniID)]; step != nil {
-			step.Effect.(*Solid).duration = holdTime
-		}
+		p.ownedSeq.SetStepEffect("solid"+strconv.Itoa(uniID), NewTimedSolid(RGBAFromRGBHex(color), holdTime))
 	}
 }
 
@@ -359,9 +413,9 @@ func (p *Portal) updateResonator(index int, newStatus *ResonatorStatus) {
 			p.resonators[index].clear()
 			// logger.Printf("Enqueuing 2 animations for index %d\n", index)
 			p.resonators[index].enqueue(NewInterpolateToHexRGB(resoColor, time.Second))
-			p.resonators[index].enqueue(NewDimmingPulse(RGBAFromRGBHex(resoColor), resoDimRatio, resoPulseDuration))
+			p.resonators[index].enqueue(NewLoop(NewDimmingPulse(RGBAFromRGBHex(resoColor), resoDimRatio, resoPulseDuration)))
 		}
-		p.resonators[index].peek().Start(time.Now())
+		p.resonators[index].peek().Start(p.clock.Now())
 	}
 }
 
@@ -375,18 +429,12 @@ func (p *Portal) getResoFrame(index int, frameTime time.Time) {
 	buf, done := currAnim.Frame(p.frameBuf[index].Data, frameTime)
 	applyBrightness(p.frameBuf[index].Data, p.currentStatus.Resonators[index].Health/100.0)
 	p.frameBuf[index].Data = buf
-	// Resonator animations run in a continuous loop, so restart if done
-	if done {
-		if p.resonators[index].size() == 1 {
-			// Only 1 animation - restart it
-			currAnim.Start(frameTime)
-		} else {
-			// More animations queued - move on to the Next
-			// We know it's > 1 because we returned early if there were 0
-			// logger.Printf("Dequeuing animation for index %d\n", index)
-			p.resonators[index].dequeue()
-			p.resonators[index].peek().Start(frameTime)
-		}
+	// Move on to the next queued animation when this one completes. The last
+	// animation queued for a resonator runs continuously, so is never dequeued
+	if done && p.resonators[index].size() > 1 {
+		// logger.Printf("Dequeuing animation for index %d\n", index)
+		p.resonators[index].dequeue()
+		p.resonators[index].peek().Start(frameTime)
 	}
 }
 
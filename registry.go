@@ -0,0 +1,593 @@
+package animation
+
+/*
+A registry of effects by name. Each effect declares a schema for its
+parameters, so that effects can be created from data files - with parameter
+values validated and converted to the right types - and so that a UI can list
+the effects available and what they accept.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParamType identifies the type of an effect parameter
+type ParamType int
+
+const (
+	// ParamColor is a color.RGBA. Given as a string "#rrggbb" or "0xrrggbb", or a
+	// 24-bit RGB number
+	ParamColor ParamType = iota
+	// ParamDuration is a time.Duration. Given as a string such as "250ms" or
+	// "1.5s", or a number of milliseconds
+	ParamDuration
+	// ParamEasing is an EasingFunc. Given as the name of an easing
+	ParamEasing
+	// ParamPalette is a Palette. Given as the name of a palette, or a list of colors
+	ParamPalette
+	// ParamCount is a non-negative int
+	ParamCount
+	// ParamFloat is a float64
+	ParamFloat
+	// ParamBool is a bool
+	ParamBool
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamColor:
+		return "color"
+	case ParamDuration:
+		return "duration"
+	case ParamEasing:
+		return "easing"
+	case ParamPalette:
+		return "palette"
+	case ParamCount:
+		return "count"
+	case ParamFloat:
+		return "float"
+	case ParamBool:
+		return "bool"
+	}
+	return "unknown"
+}
+
+// ParamSpec describes a parameter accepted by an effect
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Description string
+	Required    bool        // Must a value be provided?
+	Default     interface{} // Value used if none is provided, in any form accepted for the type
+	Min, Max    float64     // Limits for count and float parameters; ignored if equal
+}
+
+// Params holds validated parameter values, converted to the Go types
+// corresponding to their ParamTypes
+type Params map[string]interface{}
+
+// Color gets a color parameter
+func (p Params) Color(name string) color.RGBA {
+	c, _ := p[name].(color.RGBA)
+	return c
+}
+
+// Duration gets a duration parameter
+func (p Params) Duration(name string) time.Duration {
+	d, _ := p[name].(time.Duration)
+	return d
+}
+
+// Easing gets an easing parameter
+func (p Params) Easing(name string) EasingFunc {
+	e, ok := p[name].(EasingFunc)
+	if !ok {
+		return Easings["linear"]
+	}
+	return e
+}
+
+// Palette gets a palette parameter
+func (p Params) Palette(name string) Palette {
+	pal, _ := p[name].(Palette)
+	return pal
+}
+
+// Count gets a count parameter
+func (p Params) Count(name string) int {
+	c, _ := p[name].(int)
+	return c
+}
+
+// Float gets a float parameter
+func (p Params) Float(name string) float64 {
+	f, _ := p[name].(float64)
+	return f
+}
+
+// Bool gets a bool parameter
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// Rand creates a random source seeded from the "seed" count parameter
+func (p Params) Rand() *rand.Rand {
+	return rand.New(rand.NewSource(int64(p.Count("seed"))))
+}
+
+// EffectFactory creates an effect from validated parameters
+type EffectFactory func(params Params) (Animation, error)
+
+// EffectDef defines a named effect
+type EffectDef struct {
+	Description string
+	Params      []ParamSpec
+	Factory     EffectFactory
+}
+
+// EffectRegistry maps effect names to their definitions
+type EffectRegistry struct {
+	defs map[string]EffectDef
+	sync.RWMutex
+}
+
+// NewEffectRegistry creates an empty EffectRegistry
+func NewEffectRegistry() *EffectRegistry {
+	return &EffectRegistry{defs: make(map[string]EffectDef)}
+}
+
+// DefaultRegistry contains the built-in effects
+var DefaultRegistry = NewEffectRegistry()
+
+// Register adds an effect definition to the registry. Returns an error if the
+// name is already taken or the definition is incomplete
+func (r *EffectRegistry) Register(name string, def EffectDef) error {
+	if def.Factory == nil {
+		return fmt.Errorf("effect \"%s\" has no factory", name)
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.defs[name]; exists {
+		return fmt.Errorf("effect \"%s\" is already registered", name)
+	}
+	r.defs[name] = def
+	return nil
+}
+
+// Names lists the registered effects, in alphabetical order
+func (r *EffectRegistry) Names() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	names := make([]string, 0, len(r.defs))
+	for name := range r.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup gets the definition of an effect, including its parameter schema
+func (r *EffectRegistry) Lookup(name string) (EffectDef, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	def, ok := r.defs[name]
+	if !ok {
+		return def, fmt.Errorf("\"%s\" is not a known effect", name)
+	}
+	return def, nil
+}
+
+// Validate checks raw parameter values against an effect's schema, returning
+// them converted to their proper types, with defaults filled in
+func (r *EffectRegistry) Validate(name string, raw map[string]interface{}) (Params, error) {
+	def, err := r.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	params := make(Params, len(def.Params))
+	known := make(map[string]bool, len(def.Params))
+	for _, spec := range def.Params {
+		known[spec.Name] = true
+		value, present := raw[spec.Name]
+		if !present {
+			if spec.Required {
+				return nil, fmt.Errorf("effect \"%s\": missing required parameter \"%s\"", name, spec.Name)
+			}
+			if spec.Default == nil {
+				continue
+			}
+			value = spec.Default
+		}
+		converted, err := convertParam(spec, value)
+		if err != nil {
+			return nil, fmt.Errorf("effect \"%s\": parameter \"%s\": %v", name, spec.Name, err)
+		}
+		params[spec.Name] = converted
+	}
+	for paramName := range raw {
+		if !known[paramName] {
+			return nil, fmt.Errorf("effect \"%s\": unknown parameter \"%s\"", name, paramName)
+		}
+	}
+	return params, nil
+}
+
+// Create creates an instance of the named effect from raw parameter values
+func (r *EffectRegistry) Create(name string, raw map[string]interface{}) (Animation, error) {
+	params, err := r.Validate(name, raw)
+	if err != nil {
+		return nil, err
+	}
+	def, _ := r.Lookup(name)
+	effect, err := def.Factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("effect \"%s\": %v", name, err)
+	}
+	return effect, nil
+}
+
+// convertParam converts a raw value to the type required by spec
+func convertParam(spec ParamSpec, value interface{}) (interface{}, error) {
+	switch spec.Type {
+	case ParamColor:
+		return parseColor(value)
+	case ParamDuration:
+		return parseDuration(value)
+	case ParamEasing:
+		switch v := value.(type) {
+		case EasingFunc:
+			return v, nil
+		case string:
+			return LookupEasing(v)
+		}
+	case ParamPalette:
+		switch v := value.(type) {
+		case Palette:
+			return v, nil
+		case string:
+			return LookupPalette(v)
+		case []interface{}:
+			p := make(Palette, len(v))
+			for idx, c := range v {
+				parsed, err := parseColor(c)
+				if err != nil {
+					return nil, fmt.Errorf("palette entry %d: %v", idx, err)
+				}
+				p[idx] = parsed
+			}
+			return p, nil
+		}
+	case ParamCount:
+		f, err := parseNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		if f != math.Trunc(f) || f < 0 {
+			return nil, fmt.Errorf("%v is not a whole, non-negative number", value)
+		}
+		if err := checkRange(spec, f); err != nil {
+			return nil, err
+		}
+		return int(f), nil
+	case ParamFloat:
+		f, err := parseNumber(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRange(spec, f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case ParamBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%v (%T) is not a valid %v", value, value, spec.Type)
+}
+
+func checkRange(spec ParamSpec, f float64) error {
+	if spec.Min != spec.Max && (f < spec.Min || f > spec.Max) {
+		return fmt.Errorf("%v is outside the range %v to %v", f, spec.Min, spec.Max)
+	}
+	return nil
+}
+
+func parseNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("%v (%T) is not a number", value, value)
+}
+
+func parseColor(value interface{}) (color.RGBA, error) {
+	switch v := value.(type) {
+	case color.RGBA:
+		return v, nil
+	case string:
+		s := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(v), "#"), "0x")
+		hex, err := strconv.ParseUint(s, 16, 32)
+		if err != nil || len(s) != 6 {
+			return color.RGBA{}, fmt.Errorf("\"%s\" is not a color of the form #rrggbb", v)
+		}
+		return RGBAFromRGBHex(uint32(hex)), nil
+	}
+	f, err := parseNumber(value)
+	if err != nil || f < 0 || f > 0xffffff || f != math.Trunc(f) {
+		return color.RGBA{}, fmt.Errorf("%v (%T) is not a color", value, value)
+	}
+	return RGBAFromRGBHex(uint32(f)), nil
+}
+
+func parseDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	f, err := parseNumber(value)
+	if err != nil {
+		return 0, errors.New("durations must be strings such as \"250ms\" or numbers of milliseconds")
+	}
+	return time.Duration(f * float64(time.Millisecond)), nil
+}
+
+func init() {
+	registerBuiltinEffects(DefaultRegistry)
+}
+
+// Parameter specs shared by many of the built-in effects
+var (
+	seedParam = ParamSpec{Name: "seed", Type: ParamCount, Description: "Seed for random choices", Default: 0}
+)
+
+func registerBuiltinEffects(r *EffectRegistry) {
+	must := func(name string, def EffectDef) {
+		if err := r.Register(name, def); err != nil {
+			panic(err)
+		}
+	}
+
+	must("solid", EffectDef{
+		Description: "A solid color, which runs until stopped",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewSolid(p.Color("color")), nil
+		},
+	})
+	must("timedSolid", EffectDef{
+		Description: "A solid color for a fixed time",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "duration", Type: ParamDuration, Required: true},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewTimedSolid(p.Color("color"), p.Duration("duration")), nil
+		},
+	})
+	must("interpolate", EffectDef{
+		Description: "A transition from one solid color to another",
+		Params: []ParamSpec{
+			{Name: "from", Type: ParamColor, Required: true},
+			{Name: "to", Type: ParamColor, Required: true},
+			{Name: "duration", Type: ParamDuration, Required: true},
+			{Name: "easing", Type: ParamEasing, Default: "linear"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			d := p.Duration("duration")
+			return NewEased(NewInterpolateSolid(p.Color("from"), p.Color("to"), d), p.Easing("easing"), d), nil
+		},
+	})
+	must("interpolateTo", EffectDef{
+		Description: "A transition from the universe's current color to another",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "duration", Type: ParamDuration, Required: true},
+			{Name: "easing", Type: ParamEasing, Default: "linear"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			c := p.Color("color")
+			d := p.Duration("duration")
+			effect := NewInterpolateToHexRGB(uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B), d)
+			return NewEased(effect, p.Easing("easing"), d), nil
+		},
+	})
+	must("pulse", EffectDef{
+		Description: "A repeating, sinusoidal pulse between two colors",
+		Params: []ParamSpec{
+			{Name: "color1", Type: ParamColor, Required: true},
+			{Name: "color2", Type: ParamColor, Required: true},
+			{Name: "period", Type: ParamDuration, Required: true},
+			{Name: "singleCycle", Type: ParamBool, Default: false, Description: "Complete after one cycle?"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewPulse(p.Color("color1"), p.Color("color2"), p.Duration("period"), p.Bool("singleCycle")), nil
+		},
+	})
+	must("dimmingPulse", EffectDef{
+		Description: "A repeating pulse between a color and a dimmer version of itself",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "dimmingRatio", Type: ParamFloat, Default: resoDimRatio, Min: 0.0, Max: 1.0},
+			{Name: "period", Type: ParamDuration, Required: true},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewDimmingPulse(p.Color("color"), p.Float("dimmingRatio"), p.Duration("period")), nil
+		},
+	})
+	must("gradient", EffectDef{
+		Description: "A palette spread across the universe as a gradient",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Required: true},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewStaticGradient(p.Palette("palette").Gradient()), nil
+		},
+	})
+	must("scrollingGradient", EffectDef{
+		Description: "A palette spread across the universe as a gradient, scrolling along",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Required: true},
+			{Name: "period", Type: ParamDuration, Required: true, Description: "Time to scroll the length of the universe"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewScrollingGradient(p.Palette("palette").Gradient(), p.Duration("period")), nil
+		},
+	})
+	must("rainbow", EffectDef{
+		Description: "Cycling through the hues of the rainbow",
+		Params: []ParamSpec{
+			{Name: "period", Type: ParamDuration, Required: true},
+			{Name: "spread", Type: ParamFloat, Default: 1.0, Description: "Fraction of the hues shown across the universe at once"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewRainbow(p.Duration("period"), p.Float("spread")), nil
+		},
+	})
+	must("paletteIndex", EffectDef{
+		Description: "Bands of each palette color in turn, optionally shifting through the palette",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Required: true},
+			{Name: "width", Type: ParamCount, Default: 1, Min: 1, Max: 1000, Description: "Pixels per palette color"},
+			{Name: "shift", Type: ParamDuration, Default: 0, Description: "Time between shifts through the palette; 0 for none"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			pal := p.Palette("palette")
+			width := p.Count("width")
+			indices := make([]int, len(pal)*width)
+			for idx := range indices {
+				indices[idx] = idx / width
+			}
+			return NewPaletteIndex(pal, indices, p.Duration("shift")), nil
+		},
+	})
+	must("sparkle", EffectDef{
+		Description: "Randomly lit pixels",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "density", Type: ParamFloat, Default: 0.2, Min: 0.0, Max: 1.0},
+			{Name: "interval", Type: ParamDuration, Default: "100ms"},
+			seedParam,
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewSparkle(p.Color("color"), p.Float("density"), p.Duration("interval"), p.Rand()), nil
+		},
+	})
+	must("twinkle", EffectDef{
+		Description: "Random pixels fading in and out",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "rate", Type: ParamFloat, Default: 0.5, Description: "Twinkles per pixel per second"},
+			{Name: "duration", Type: ParamDuration, Default: "500ms"},
+			seedParam,
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewTwinkle(p.Color("color"), p.Float("rate"), p.Duration("duration"), p.Rand()), nil
+		},
+	})
+	must("noise", EffectDef{
+		Description: "Smoothly varying noise, colored from a palette",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Required: true},
+			{Name: "scale", Type: ParamFloat, Default: 8.0},
+			{Name: "speed", Type: ParamFloat, Default: 1.0},
+			seedParam,
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewNoise(p.Palette("palette").Gradient(), p.Float("scale"), p.Float("speed"), int64(p.Count("seed"))), nil
+		},
+	})
+	must("fire", EffectDef{
+		Description: "A fire simulation",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Default: "fire"},
+			{Name: "intensity", Type: ParamFloat, Default: 0.5, Min: 0.0, Max: 1.0},
+			{Name: "speed", Type: ParamFloat, Default: 60.0, Description: "Simulation steps per second"},
+			seedParam,
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewFire(p.Palette("palette").Gradient(), p.Float("intensity"), p.Float("speed"), p.Rand()), nil
+		},
+	})
+	must("plasma", EffectDef{
+		Description: "A flowing plasma pattern",
+		Params: []ParamSpec{
+			{Name: "palette", Type: ParamPalette, Required: true},
+			{Name: "intensity", Type: ParamFloat, Default: 1.0, Min: 0.0, Max: 1.0},
+			{Name: "speed", Type: ParamFloat, Default: 1.0},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewPlasma(p.Palette("palette").Gradient(), p.Float("intensity"), p.Float("speed")), nil
+		},
+	})
+	must("strobe", EffectDef{
+		Description: "A color flashing on and off. Subject to the portal's safety limits",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "frequency", Type: ParamFloat, Default: 2.0, Min: 0.01, Max: 50.0},
+			{Name: "duty", Type: ParamFloat, Default: 0.5, Min: 0.0, Max: 1.0},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewStrobe(p.Color("color"), p.Float("frequency"), p.Float("duty")), nil
+		},
+	})
+	must("flash", EffectDef{
+		Description: "A single flash of color, decaying to black",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Required: true},
+			{Name: "duration", Type: ParamDuration, Default: "500ms"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewFlash(p.Color("color"), p.Duration("duration")), nil
+		},
+	})
+	must("lightning", EffectDef{
+		Description: "A burst of irregular flickers",
+		Params: []ParamSpec{
+			{Name: "color", Type: ParamColor, Default: "#ffffff"},
+			{Name: "duration", Type: ParamDuration, Default: "1s"},
+			seedParam,
+		},
+		Factory: func(p Params) (Animation, error) {
+			return NewLightning(p.Color("color"), p.Duration("duration"), p.Rand()), nil
+		},
+	})
+	must("meter", EffectDef{
+		Description: "A bar graph showing a fixed value",
+		Params: []ParamSpec{
+			{Name: "fill", Type: ParamColor, Required: true},
+			{Name: "empty", Type: ParamColor, Default: "#000000"},
+			{Name: "value", Type: ParamFloat, Required: true, Min: 0.0, Max: 100.0},
+			{Name: "segments", Type: ParamCount, Default: 0, Description: "Number of segments; 0 for a continuous meter"},
+		},
+		Factory: func(p Params) (Animation, error) {
+			m := NewSegmentedMeter(p.Color("fill"), p.Color("empty"), p.Count("segments"), 0)
+			m.SetValue(p.Float("value"))
+			return m, nil
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package animation
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryCreate(t *testing.T) {
+	effect, err := DefaultRegistry.Create("timedSolid", map[string]interface{}{
+		"color":    "#ff8000",
+		"duration": "100ms",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	start := time.Unix(0, 0)
+	effect.Start(start)
+	buf := make([]color.RGBA, 3)
+	buf, done := effect.Frame(buf, start.Add(50*time.Millisecond))
+	if done {
+		t.Fatalf("Effect finished early")
+	}
+	if buf[1] != (color.RGBA{0xff, 0x80, 0x00, 0xff}) {
+		t.Fatalf("Unexpected color %v", buf[1])
+	}
+	if _, done = effect.Frame(buf, start.Add(150*time.Millisecond)); !done {
+		t.Fatalf("Effect didn't finish after its duration")
+	}
+}
+
+func TestRegistryValidate(t *testing.T) {
+	params, err := DefaultRegistry.Validate("sparkle", map[string]interface{}{
+		"color":    float64(0x00ff00),
+		"interval": float64(250),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.Color("color") != (color.RGBA{0, 0xff, 0, 0xff}) {
+		t.Fatalf("Unexpected color %v", params.Color("color"))
+	}
+	if params.Duration("interval") != 250*time.Millisecond {
+		t.Fatalf("Numeric duration not treated as milliseconds: %v", params.Duration("interval"))
+	}
+	if params.Float("density") != 0.2 {
+		t.Fatalf("Default not filled in; density is %v", params.Float("density"))
+	}
+
+	bad := []struct {
+		raw  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{}, "missing required parameter \"color\""},
+		{map[string]interface{}{"color": "green"}, "parameter \"color\""},
+		{map[string]interface{}{"color": "#00ff00", "density": 2.0}, "outside the range"},
+		{map[string]interface{}{"color": "#00ff00", "seed": 1.5}, "parameter \"seed\""},
+		{map[string]interface{}{"color": "#00ff00", "colour": "#00ff00"}, "unknown parameter \"colour\""},
+	}
+	for _, b := range bad {
+		_, err := DefaultRegistry.Validate("sparkle", b.raw)
+		if err == nil || !strings.Contains(err.Error(), b.want) {
+			t.Fatalf("Expected error containing %q for %v; got %v", b.want, b.raw, err)
+		}
+	}
+
+	if _, err := DefaultRegistry.Validate("nonesuch", nil); err == nil {
+		t.Fatalf("Expected error for unknown effect")
+	}
+}
+
+func TestRegistryPalettes(t *testing.T) {
+	params, err := DefaultRegistry.Validate("gradient", map[string]interface{}{
+		"palette": []interface{}{"#000000", "#ffffff"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(params.Palette("palette")) != 2 {
+		t.Fatalf("Unexpected palette %v", params.Palette("palette"))
+	}
+	if _, err = DefaultRegistry.Validate("gradient", map[string]interface{}{"palette": "enl"}); err != nil {
+		t.Fatalf("Named palette rejected: %v", err)
+	}
+}
+
+func TestRegistryBuiltins(t *testing.T) {
+	// Every built-in effect should be creatable from its required parameters, and
+	// cloneable, so each run of a step gets a fresh instance
+	samples := map[ParamType]interface{}{
+		ParamColor:    "#123456",
+		ParamDuration: "1s",
+		ParamEasing:   "easeInOut",
+		ParamPalette:  "res",
+		ParamCount:    1,
+		ParamFloat:    0.5,
+		ParamBool:     true,
+	}
+	buf := make([]color.RGBA, 10)
+	for _, name := range DefaultRegistry.Names() {
+		def, _ := DefaultRegistry.Lookup(name)
+		raw := make(map[string]interface{})
+		for _, spec := range def.Params {
+			if spec.Required {
+				raw[spec.Name] = samples[spec.Type]
+			}
+		}
+		effect, err := DefaultRegistry.Create(name, raw)
+		if err != nil {
+			t.Fatalf("Couldn't create %s: %v", name, err)
+		}
+		if _, cloneable := effect.(Cloner); !cloneable {
+			t.Fatalf("%s can't be cloned", name)
+		}
+		effect.Start(time.Unix(0, 0))
+		effect.Frame(buf, time.Unix(0, 0).Add(100*time.Millisecond))
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewEffectRegistry()
+	def := EffectDef{Factory: func(p Params) (Animation, error) { return NewSolid(white), nil }}
+	if err := r.Register("white", def); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := r.Register("white", def); err == nil {
+		t.Fatalf("Expected error registering a duplicate name")
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "white" {
+		t.Fatalf("Unexpected names %v", names)
+	}
+}
+
+func TestEased(t *testing.T) {
+	start := time.Unix(0, 0)
+	d := 100 * time.Millisecond
+	linear := NewInterpolateSolid(black, white, d)
+	eased := NewEased(NewInterpolateSolid(black, white, d), Easings["easeIn"], d)
+	linear.Start(start)
+	eased.Start(start)
+	buf := make([]color.RGBA, 1)
+
+	linear.Frame(buf, start.Add(d/2))
+	mid := buf[0].R
+	eased.Frame(buf, start.Add(d/2))
+	if buf[0].R >= mid {
+		t.Fatalf("easeIn should be behind linear at the midpoint: %d vs %d", buf[0].R, mid)
+	}
+	eased.Frame(buf, start.Add(d))
+	if buf[0] != white {
+		t.Fatalf("Eased effect should reach the end state; got %v", buf[0])
+	}
+	for name, e := range Easings {
+		if e(0.0) != 0.0 || e(1.0) < 0.9999 || e(1.0) > 1.0001 {
+			t.Fatalf("Easing %s doesn't run from 0 to 1", name)
+		}
+	}
+}
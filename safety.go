@@ -0,0 +1,201 @@
+package animation
+
+// Photosensitivity safety limits, applied to the final output of the portal so
+// that no combination of effects and sequences can exceed them
+
+import (
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TeamNorCal/animation/model"
+)
+
+const (
+	// DefaultMaxFlashRate is the default limit on flashes per second. Guidelines
+	// for photosensitive epilepsy call for fewer than 3
+	DefaultMaxFlashRate = 2.5
+	// DefaultFlashThreshold is the default swing in average luminance (as a
+	// fraction of full brightness) from a peak or trough that counts as half of a
+	// flash
+	DefaultFlashThreshold = 0.1
+	// DefaultMaxLuminanceStep is the default limit on the change in average
+	// luminance from one frame to the next
+	DefaultMaxLuminanceStep = 0.5
+	// Number of interventions retained for inspection
+	maxInterventions = 100
+)
+
+var safetyLog = log.New(os.Stderr, "(SAFETY) ", 0)
+
+// Intervention records an occasion on which the SafetyGovernor altered output
+type Intervention struct {
+	Time      time.Time // Frame time at which the intervention happened
+	Reason    string    // Which limit would have been exceeded
+	Requested float64   // The change in average luminance the frame asked for
+	Allowed   float64   // The change in average luminance actually permitted
+}
+
+// SafetyGovernor limits the rate of flashing and the size of sudden changes in
+// brightness across an entire frame of output. It does this by holding the
+// output partway between the previous frame and the requested frame whenever
+// a limit would be exceeded.
+// Flashes are counted on the total swing in luminance since the last peak or
+// trough, however many frames it takes, so a strobe can't get past the limit
+// by changing gradually
+type SafetyGovernor struct {
+	MaxFlashRate     float64 // Maximum flashes per second. A flash is a rise and a fall in luminance
+	FlashThreshold   float64 // Swing in average luminance, 0.0-1.0, from a peak or trough counted as a rise or fall
+	MaxLuminanceStep float64 // Maximum change in average luminance, 0.0-1.0, in a single frame
+
+	prevFrame     [][]color.RGBA // Copy of the last output, by channel
+	prevLuma      float64        // Average luminance of the last output
+	transitions   []time.Time    // Times of recent rises and falls in luminance
+	extreme       float64        // Luminance of the peak (if rising) or trough (if falling) since the last transition
+	rising        bool           // Was the last transition a rise?
+	intervening   bool           // Did we intervene in the last frame?
+	interventions []Intervention // Recent interventions, oldest first
+	sync.Mutex
+}
+
+// NewSafetyGovernor creates a SafetyGovernor with default limits
+func NewSafetyGovernor() *SafetyGovernor {
+	return &SafetyGovernor{
+		MaxFlashRate:     DefaultMaxFlashRate,
+		FlashThreshold:   DefaultFlashThreshold,
+		MaxLuminanceStep: DefaultMaxLuminanceStep,
+	}
+}
+
+// Apply enforces the limits on a frame of output, modifying it in place if
+// necessary. frameTime should increase monotonically with each call
+func (g *SafetyGovernor) Apply(frame []model.ChannelData, frameTime time.Time) {
+	g.Lock()
+	defer g.Unlock()
+
+	if len(g.prevFrame) != len(frame) {
+		// First frame (or the layout changed) - nothing to compare against
+		g.remember(frame, frameLuma(frame))
+		g.extreme = g.prevLuma
+		return
+	}
+
+	// Forget transitions more than a second old
+	cutoff := frameTime.Add(-time.Second)
+	for len(g.transitions) > 0 && !g.transitions[0].After(cutoff) {
+		g.transitions = g.transitions[1:]
+	}
+
+	luma := frameLuma(frame)
+	lo, hi := g.prevLuma-g.MaxLuminanceStep, g.prevLuma+g.MaxLuminanceStep
+	loReason, hiReason := "luminance step", "luminance step"
+	if float64(len(g.transitions)+1) > 2*g.MaxFlashRate {
+		// Another transition would be one too many, so keep the swing back from
+		// the last peak or trough below the threshold
+		if g.rising && g.extreme-g.FlashThreshold*0.99 > lo {
+			lo, loReason = g.extreme-g.FlashThreshold*0.99, "flash rate"
+		} else if !g.rising && g.extreme+g.FlashThreshold*0.99 < hi {
+			hi, hiReason = g.extreme+g.FlashThreshold*0.99, "flash rate"
+		}
+	}
+
+	target, reason := luma, ""
+	if luma < lo {
+		target, reason = lo, loReason
+	} else if luma > hi {
+		target, reason = hi, hiReason
+	}
+	if reason != "" {
+		// Luminance is linear in the mix of the previous and requested frames
+		ratio := 0.0
+		if luma != g.prevLuma {
+			ratio = math.Max(0.0, math.Min(1.0, (target-g.prevLuma)/(luma-g.prevLuma)))
+		}
+		for ch := range frame {
+			prev := g.prevFrame[ch]
+			data := frame[ch].Data
+			for idx := range data {
+				if idx < len(prev) {
+					data[idx] = blendRGBA(prev[idx], data[idx], ratio)
+				}
+			}
+		}
+		g.record(Intervention{frameTime, reason, math.Abs(luma - g.prevLuma), math.Abs(target - g.prevLuma)})
+		luma = frameLuma(frame)
+	} else {
+		g.intervening = false
+	}
+
+	g.track(luma, frameTime)
+	g.remember(frame, luma)
+}
+
+// track follows the peaks and troughs of luminance, counting a transition each
+// time it swings back from one by more than the threshold
+func (g *SafetyGovernor) track(luma float64, frameTime time.Time) {
+	switch {
+	case g.rising && luma > g.extreme, !g.rising && luma < g.extreme:
+		// Still rising to a peak, or falling to a trough
+		g.extreme = luma
+	case math.Abs(luma-g.extreme) > g.FlashThreshold:
+		g.transitions = append(g.transitions, frameTime)
+		g.rising = !g.rising
+		g.extreme = luma
+	}
+}
+
+// Interventions returns a copy of the record of recent interventions, oldest
+// first
+func (g *SafetyGovernor) Interventions() []Intervention {
+	g.Lock()
+	defer g.Unlock()
+
+	return append([]Intervention(nil), g.interventions...)
+}
+
+// record notes an intervention, logging it if it's the start of a run of them
+func (g *SafetyGovernor) record(i Intervention) {
+	if !g.intervening {
+		safetyLog.Printf("Limiting %s at %v: change of %.2f reduced to %.2f\n",
+			i.Reason, i.Time, i.Requested, i.Allowed)
+	}
+	g.intervening = true
+	if len(g.interventions) >= maxInterventions {
+		g.interventions = g.interventions[1:]
+	}
+	g.interventions = append(g.interventions, i)
+}
+
+// remember retains a copy of the frame for comparison with the next
+func (g *SafetyGovernor) remember(frame []model.ChannelData, luma float64) {
+	if len(g.prevFrame) != len(frame) {
+		g.prevFrame = make([][]color.RGBA, len(frame))
+	}
+	for ch := range frame {
+		g.prevFrame[ch] = append(g.prevFrame[ch][:0], frame[ch].Data...)
+	}
+	g.prevLuma = luma
+}
+
+// frameLuma gives the average luminance of all pixels in a frame, 0.0-1.0
+func frameLuma(frame []model.ChannelData) float64 {
+	total, count := 0.0, 0
+	for _, ch := range frame {
+		for _, c := range ch.Data {
+			total += float64(luma(c))
+			count++
+		}
+	}
+	if count == 0 {
+		return 0.0
+	}
+	return total / float64(count) / 255.0
+}
+
+// blendRGBA linearly interpolates from a to b
+func blendRGBA(a, b color.RGBA, ratio float64) color.RGBA {
+	return color.RGBA{mix(a.R, b.R, ratio), mix(a.G, b.G, ratio), mix(a.B, b.B, ratio), mix(a.A, b.A, ratio)}
+}
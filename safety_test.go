@@ -0,0 +1,93 @@
+package animation
+
+import (
+	"image/color"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/TeamNorCal/animation/model"
+)
+
+func TestGovernorLimitsStrobe(t *testing.T) {
+	g := NewSafetyGovernor()
+	strobe := NewStrobe(white, 10.0, 0.5)
+	now := time.Unix(0, 0)
+	strobe.Start(now)
+	frame := []model.ChannelData{{ChannelNum: 1, Data: make([]color.RGBA, windowSize)}}
+
+	// Record the output luminance over a few seconds
+	var lumas []float64
+	for tick := 0; tick < 300; tick++ {
+		frameTime := now.Add(time.Duration(tick) * 10 * time.Millisecond)
+		strobe.Frame(frame[0].Data, frameTime)
+		g.Apply(frame, frameTime)
+		lumas = append(lumas, frameLuma(frame))
+	}
+	if len(g.Interventions()) == 0 {
+		t.Fatal("No interventions recorded")
+	}
+
+	// Find the swings in the output: each time the luminance turns back from a
+	// peak or trough by more than the threshold, however gradually
+	var swings []int
+	rising, extreme := false, lumas[0]
+	for tick, l := range lumas {
+		if (rising && l > extreme) || (!rising && l < extreme) {
+			extreme = l
+		} else if math.Abs(l-extreme) > g.FlashThreshold {
+			swings = append(swings, tick)
+			rising, extreme = !rising, l
+		}
+	}
+	for idx := range swings {
+		// Ticks are 10ms apart, so a second is 100 ticks
+		inSecond := 0
+		for _, tick := range swings[idx:] {
+			if tick-swings[idx] < 100 {
+				inSecond++
+			}
+		}
+		if float64(inSecond) > 2*g.MaxFlashRate {
+			t.Fatalf("%d swings in the second from %dms exceeds limit", inSecond, swings[idx]*10)
+		}
+	}
+	if len(swings) < 5 {
+		t.Fatalf("Expected the strobe to get through up to the limit; got %d swings", len(swings))
+	}
+	// Once the limit is reached, the output is held steady until the first
+	// swing is a second old
+	high, low := 0.0, 1.0
+	for _, l := range lumas[swings[4]+1 : swings[0]+100] {
+		high, low = math.Max(high, l), math.Min(low, l)
+	}
+	if high-low > g.FlashThreshold {
+		t.Fatalf("Luminance swung between %.2f and %.2f after reaching the limit", low, high)
+	}
+}
+
+func TestGovernorPassesSlowChanges(t *testing.T) {
+	g := NewSafetyGovernor()
+	now := time.Unix(0, 0)
+	frame := []model.ChannelData{{ChannelNum: 1, Data: make([]color.RGBA, windowSize)}}
+	g.Apply(frame, now)
+	// A gentle fade in shouldn't be touched
+	for tick := 1; tick <= 50; tick++ {
+		for idx := range frame[0].Data {
+			frame[0].Data[idx] = scaleColor(white, float64(tick)/50.0)
+		}
+		g.Apply(frame, now.Add(time.Duration(tick)*20*time.Millisecond))
+	}
+	if len(g.Interventions()) != 0 {
+		t.Fatalf("Unexpected interventions: %v", g.Interventions())
+	}
+
+	// ...but a sudden jump to black should be limited
+	for idx := range frame[0].Data {
+		frame[0].Data[idx] = black
+	}
+	g.Apply(frame, now.Add(2*time.Second))
+	if l := frameLuma(frame); l < 0.49 {
+		t.Fatalf("Large step not limited: luminance %v", l)
+	}
+}
@@ -0,0 +1,208 @@
+package animation
+
+// Scheduling of whole sequences onto a SequenceRunner, deciding what runs next
+// when several are requested
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Policy determines what happens to a sequence submitted to a scheduler while
+// another is running
+type Policy int
+
+const (
+	// PolicyQueue waits for the sequences running and queued ahead of it.
+	// Higher priority sequences are queued ahead of lower priority ones
+	PolicyQueue Policy = iota
+	// PolicyPreempt starts the sequence straight away, replacing the running
+	// one, unless that has a higher priority, in which case it's queued as for
+	// PolicyQueue. Either way, queued sequences of the same or lower priority
+	// are discarded, as being out of date
+	PolicyPreempt
+	// PolicyMerge replaces a queued sequence of the same name, taking its place
+	// in the queue, or queues the sequence as for PolicyQueue if there's none
+	PolicyMerge
+	// PolicyDropIfBusy starts the sequence if nothing is running or queued, and
+	// otherwise discards it
+	PolicyDropIfBusy
+)
+
+// Overflow determines what happens when a sequence is queued on a full queue
+type Overflow int
+
+const (
+	// OverflowReject refuses the new sequence
+	OverflowReject Overflow = iota
+	// OverflowDropLowest discards the lowest priority queued sequence (the
+	// oldest, if there are several) to make room. If the new sequence has a
+	// lower priority than everything queued, it's refused instead
+	OverflowDropLowest
+)
+
+var (
+	// ErrQueueFull is returned when a sequence is refused because the queue is
+	// full
+	ErrQueueFull = errors.New("sequence queue is full")
+	// ErrBusy is returned when a sequence submitted with PolicyDropIfBusy is
+	// discarded
+	ErrBusy = errors.New("sequence scheduler is busy")
+)
+
+// SequenceRequest is a sequence submitted to a scheduler
+type SequenceRequest struct {
+	Name     string    // Identifies the sequence, for merging and introspection
+	Sequence *Sequence // The sequence to run
+	Priority int       // Higher priorities run first
+	Policy   Policy    // What to do if something is already running
+}
+
+// SequenceScheduler runs sequences on a SequenceRunner one at a time, queueing
+// or preempting according to the policy and priority they're submitted with
+type SequenceScheduler struct {
+	sr       *SequenceRunner
+	queue    []SequenceRequest // Waiting sequences, highest priority first
+	running  *SequenceRequest  // Currently-running sequence, if any
+	maxQueue int               // Maximum number of waiting sequences; zero for no limit
+	overflow Overflow          // What to do when the queue is full
+	sync.Mutex
+}
+
+// NewSequenceScheduler creates a scheduler running sequences on sr, with up
+// to maxQueue sequences waiting (zero for no limit)
+func NewSequenceScheduler(sr *SequenceRunner, maxQueue int, overflow Overflow) *SequenceScheduler {
+	return &SequenceScheduler{sr: sr, maxQueue: maxQueue, overflow: overflow}
+}
+
+// Runner gets the runner the scheduler runs sequences on
+func (ss *SequenceScheduler) Runner() *SequenceRunner {
+	return ss.sr
+}
+
+// Submit submits a sequence to be run, starting it at now if its policy says
+// so. Returns ErrQueueFull or ErrBusy if the sequence was discarded
+func (ss *SequenceScheduler) Submit(req SequenceRequest, now time.Time) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	idle := ss.running == nil && len(ss.queue) == 0
+	switch req.Policy {
+	case PolicyPreempt:
+		ss.discardQueued(req.Priority)
+		if ss.running == nil || ss.running.Priority <= req.Priority {
+			ss.start(req, now)
+			return nil
+		}
+	case PolicyMerge:
+		for idx := range ss.queue {
+			if req.Name != "" && ss.queue[idx].Name == req.Name {
+				ss.queue[idx].Sequence = req.Sequence
+				return nil
+			}
+		}
+	case PolicyDropIfBusy:
+		if !idle {
+			return ErrBusy
+		}
+	}
+	if idle {
+		ss.start(req, now)
+		return nil
+	}
+	return ss.enqueue(req)
+}
+
+// ProcessFrame generates frame data on the runner, starting the next queued
+// sequence once the running one completes. Returns whether there's nothing
+// running or queued
+func (ss *SequenceScheduler) ProcessFrame(now time.Time) (done bool) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if !ss.sr.ProcessFrame(now) {
+		return false
+	}
+	ss.running = nil
+	if len(ss.queue) == 0 {
+		return true
+	}
+	next := ss.queue[0]
+	ss.queue = append(ss.queue[:0], ss.queue[1:]...)
+	ss.start(next, now)
+	return false
+}
+
+// Running gets the currently-running sequence, if any
+func (ss *SequenceScheduler) Running() (req SequenceRequest, running bool) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if ss.running == nil {
+		return SequenceRequest{}, false
+	}
+	return *ss.running, true
+}
+
+// Queued gets the waiting sequences, in the order they'll run
+func (ss *SequenceScheduler) Queued() []SequenceRequest {
+	ss.Lock()
+	defer ss.Unlock()
+
+	return append([]SequenceRequest(nil), ss.queue...)
+}
+
+// Clear discards all waiting sequences, leaving the running one alone
+func (ss *SequenceScheduler) Clear() {
+	ss.Lock()
+	defer ss.Unlock()
+
+	ss.queue = ss.queue[:0]
+}
+
+func (ss *SequenceScheduler) start(req SequenceRequest, now time.Time) {
+	ss.running = &req
+	ss.sr.InitSequence(req.Sequence, now)
+}
+
+// enqueue adds a request to the queue behind those of the same or higher
+// priority, dealing with overflow
+func (ss *SequenceScheduler) enqueue(req SequenceRequest) error {
+	if ss.maxQueue > 0 && len(ss.queue) >= ss.maxQueue {
+		if ss.overflow == OverflowReject {
+			return ErrQueueFull
+		}
+		// Lowest priority is at the back; find the oldest of those
+		lowest := len(ss.queue) - 1
+		if ss.queue[lowest].Priority > req.Priority {
+			return ErrQueueFull
+		}
+		for lowest > 0 && ss.queue[lowest-1].Priority == ss.queue[lowest].Priority {
+			lowest--
+		}
+		ss.queue = append(ss.queue[:lowest], ss.queue[lowest+1:]...)
+	}
+	pos := len(ss.queue)
+	for pos > 0 && ss.queue[pos-1].Priority < req.Priority {
+		pos--
+	}
+	ss.queue = append(ss.queue, SequenceRequest{})
+	copy(ss.queue[pos+1:], ss.queue[pos:])
+	ss.queue[pos] = req
+	return nil
+}
+
+// discardQueued discards waiting sequences with priorities up to priority
+func (ss *SequenceScheduler) discardQueued(priority int) {
+	kept := ss.queue[:0]
+	for _, req := range ss.queue {
+		if req.Priority > priority {
+			kept = append(kept, req)
+		}
+	}
+	for idx := len(kept); idx < len(ss.queue); idx++ {
+		ss.queue[idx] = SequenceRequest{}
+	}
+	ss.queue = kept
+}
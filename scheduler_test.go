@@ -0,0 +1,132 @@
+package animation
+
+import (
+	"testing"
+	"time"
+)
+
+// oneShot creates a sequence showing a color for a time on universe 0
+func oneShot(d time.Duration) *Sequence {
+	return NewSequence().AddInitialStep("only", &Step{Effect: NewTimedSolid(white, d)})
+}
+
+func queuedNames(ss *SequenceScheduler) []string {
+	var names []string
+	for _, req := range ss.Queued() {
+		names = append(names, req.Name)
+	}
+	return names
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchedulerPriorities(t *testing.T) {
+	ms := time.Millisecond
+	ss := NewSequenceScheduler(NewSequenceRunner([]uint{1}), 0, OverflowReject)
+	start := time.Unix(0, 0)
+	for _, req := range []SequenceRequest{
+		{Name: "first", Priority: 0},
+		{Name: "low", Priority: 0},
+		{Name: "high", Priority: 5},
+		{Name: "mid", Priority: 2},
+		{Name: "low2", Priority: 0},
+	} {
+		req.Sequence = oneShot(50 * ms)
+		if err := ss.Submit(req, start); err != nil {
+			t.Fatalf("Unexpected error submitting %s: %v", req.Name, err)
+		}
+	}
+	if running, ok := ss.Running(); !ok || running.Name != "first" {
+		t.Fatalf("Expected first sequence to start straight away; got %+v", running)
+	}
+	if queued := queuedNames(ss); !sameNames(queued, []string{"high", "mid", "low", "low2"}) {
+		t.Fatalf("Unexpected queue order %v", queued)
+	}
+
+	var order []string
+	for elapsed := time.Duration(0); elapsed <= time.Second; elapsed += 10 * ms {
+		if running, ok := ss.Running(); ok && (len(order) == 0 || order[len(order)-1] != running.Name) {
+			order = append(order, running.Name)
+		}
+		if ss.ProcessFrame(start.Add(elapsed)) {
+			break
+		}
+	}
+	if !sameNames(order, []string{"first", "high", "mid", "low", "low2"}) {
+		t.Fatalf("Unexpected run order %v", order)
+	}
+}
+
+func TestSchedulerPolicies(t *testing.T) {
+	ms := time.Millisecond
+	ss := NewSequenceScheduler(NewSequenceRunner([]uint{1}), 0, OverflowReject)
+	now := time.Unix(0, 0)
+	submit := func(name string, priority int, policy Policy) error {
+		return ss.Submit(SequenceRequest{Name: name, Sequence: oneShot(50 * ms), Priority: priority, Policy: policy}, now)
+	}
+
+	submit("a", 1, PolicyQueue)
+	if err := submit("busy", 0, PolicyDropIfBusy); err != ErrBusy {
+		t.Fatalf("Expected ErrBusy; got %v", err)
+	}
+	submit("b", 0, PolicyQueue)
+	submit("c", 2, PolicyQueue)
+	// Merging replaces the queued b in place
+	merged := oneShot(50 * ms)
+	ss.Submit(SequenceRequest{Name: "b", Sequence: merged, Policy: PolicyMerge}, now)
+	if queued := ss.Queued(); len(queued) != 2 || queued[1].Sequence != merged {
+		t.Fatalf("Expected b to be merged; got %v", queuedNames(ss))
+	}
+	// Lower priority than the running sequence, so queued, but discards b
+	submit("d", 0, PolicyPreempt)
+	if running, _ := ss.Running(); running.Name != "a" {
+		t.Fatalf("Expected a to carry on running; got %s", running.Name)
+	}
+	if queued := queuedNames(ss); !sameNames(queued, []string{"c", "d"}) {
+		t.Fatalf("Unexpected queue after low priority preemption %v", queued)
+	}
+	// High enough priority to replace a, discarding everything queued
+	submit("e", 2, PolicyPreempt)
+	if running, _ := ss.Running(); running.Name != "e" {
+		t.Fatalf("Expected e to preempt a; got %s", running.Name)
+	}
+	if queued := queuedNames(ss); len(queued) != 0 {
+		t.Fatalf("Expected queue to be emptied; got %v", queued)
+	}
+}
+
+func TestSchedulerOverflow(t *testing.T) {
+	now := time.Unix(0, 0)
+	ss := NewSequenceScheduler(NewSequenceRunner([]uint{1}), 2, OverflowReject)
+	for _, name := range []string{"running", "a", "b"} {
+		ss.Submit(SequenceRequest{Name: name, Sequence: oneShot(time.Second)}, now)
+	}
+	if err := ss.Submit(SequenceRequest{Name: "c", Sequence: oneShot(time.Second)}, now); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull; got %v", err)
+	}
+
+	ss = NewSequenceScheduler(NewSequenceRunner([]uint{1}), 2, OverflowDropLowest)
+	for _, req := range []SequenceRequest{{Name: "running"}, {Name: "a", Priority: 1}, {Name: "b"}, {Name: "c"}} {
+		req.Sequence = oneShot(time.Second)
+		if err := ss.Submit(req, now); err != nil {
+			t.Fatalf("Unexpected error submitting %s: %v", req.Name, err)
+		}
+	}
+	// b was the oldest of the lowest priority
+	if queued := queuedNames(ss); !sameNames(queued, []string{"a", "c"}) {
+		t.Fatalf("Unexpected queue after overflow %v", queued)
+	}
+	if err := ss.Submit(SequenceRequest{Name: "lower", Priority: -1, Sequence: oneShot(time.Second)}, now); err != ErrQueueFull {
+		t.Fatalf("Expected lower priority sequence to be refused; got %v", err)
+	}
+}
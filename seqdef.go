@@ -0,0 +1,516 @@
+package animation
+
+/*
+Sequences defined in data files rather than code. A definition is a JSON
+document such as:
+
+	{
+	  "groups": {
+	    "windows": ["towerLevel1Window1", "towerLevel1Window2", "towerLevel2Window1"]
+	  },
+	  "steps": [
+	    {
+	      "name": "in{i}", "forEach": "windows",
+	      "effect": "interpolateTo", "params": {"color": "#00ff00", "duration": "250ms"},
+	      "next": [{"step": "out{i}"}, {"step": "in{i+1}", "delay": "100ms"}]
+	    },
+	    {
+	      "name": "out{i}", "forEach": "windows",
+	      "effect": "interpolateTo", "params": {"color": "#000000", "duration": "500ms"}
+	    }
+	  ],
+	  "initial": [{"step": "in0"}]
+	}
+
+Effects are created by name from an EffectRegistry, with their parameters.
+A step with "forEach" is repeated for each universe in the named group. Within
+such a step, "{i}" in a step name is replaced by the index of the universe in
+the group, and "{universe}" by its name; an offset may be given, as in
+"{i+1}", wrapping around the group. The universe of a repeated step defaults
+to "{universe}"; other steps must name their universe.
+
+A step may join other steps, starting once they complete:
+
+	"join": {"forEach": "windows", "steps": ["out{i}"], "mode": "all", "delay": "1s"}
+
+The mode is "all" (the default), "any", or "count", with "count" giving the
+number of steps required. With "forEach", each of the steps listed is repeated
+for every universe of the group, with placeholders expanded as above.
+
+Rather than being repeated, a single step can target several universes, with
+"group" naming a group or "universes" listing them. By default the universes
+share one instance of the effect; with "instances": "independent" each has its
+own. "stagger" delays the start on each successive universe.
+
+Instead of an effect, a step can run a nested sequence definition, given as
+"sequence". It uses the same universe names, and the step completes when the
+nested sequence does.
+
+Operations can branch. "if" gives a condition on a variable of the runner,
+such as {"var": "faction", "equals": "ENL"} or {"var": "level", "atLeast": 5}
+("below" is also available). "choices" lists steps to choose between at
+random, with weights: [{"step": "twinkle", "weight": 3}, {"step": "sweep"}].
+"limit" applies the operation only that many times. If the condition fails or
+the limit is reached, the step named by "otherwise" is started instead.
+
+Delays are given as strings such as "1.5s", or numbers of milliseconds.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SequenceDef is the file representation of a Sequence
+type SequenceDef struct {
+	Groups  map[string][]string `json:"groups"`  // Named lists of universes, for use with forEach
+	Steps   []StepDef           `json:"steps"`   // The steps of the sequence
+	Initial []OperationDef      `json:"initial"` // Operations to perform at the start of the sequence
+}
+
+// StepDef is the file representation of a Step
+type StepDef struct {
+	Name      string                 `json:"name"`
+	ForEach   string                 `json:"forEach"`  // Group of universes to repeat the step for
+	Universe  string                 `json:"universe"` // Name of the universe the step applies to
+	Effect    string                 `json:"effect"`   // Name of the effect in the registry
+	Params    map[string]interface{} `json:"params"`   // Parameters for the effect
+	Layer     int                    `json:"layer"`
+	Blend     string                 `json:"blend"` // Name of the BlendMode; normal if omitted
+	Opacity   float64                `json:"opacity"`
+	Next      []OperationDef         `json:"next"`
+	Join      *JoinDef               `json:"join"`
+	Group     string                 `json:"group"`     // Group of universes the step targets, instead of a single universe
+	Universes []string               `json:"universes"` // Universes the step targets, instead of a single universe
+	Stagger   interface{}            `json:"stagger"`   // Delay before starting on each successive universe
+	Instances string                 `json:"instances"` // "shared" (the default) or "independent"
+	Sequence  *SequenceDef           `json:"sequence"`  // Nested sequence to run instead of an effect
+}
+
+// JoinDef is the file representation of a Join
+type JoinDef struct {
+	ForEach string      `json:"forEach"` // Group of universes to repeat the steps for
+	Steps   []string    `json:"steps"`
+	Mode    string      `json:"mode"` // "all", "any" or "count"
+	Count   int         `json:"count"`
+	Delay   interface{} `json:"delay"`
+}
+
+// OperationDef is the file representation of an Operation
+type OperationDef struct {
+	Step      string        `json:"step"`
+	Delay     interface{}   `json:"delay"` // A duration string, or a number of milliseconds
+	If        *ConditionDef `json:"if"`
+	Choices   []ChoiceDef   `json:"choices"`
+	Limit     int           `json:"limit"`
+	Otherwise string        `json:"otherwise"`
+}
+
+// ConditionDef is the file representation of a Condition on a variable. One
+// comparison should be given
+type ConditionDef struct {
+	Var     string      `json:"var"`
+	Equals  interface{} `json:"equals"`
+	AtLeast *float64    `json:"atLeast"`
+	Below   *float64    `json:"below"`
+}
+
+// ChoiceDef is the file representation of a Choice
+type ChoiceDef struct {
+	Step   string   `json:"step"`
+	Weight *float64 `json:"weight"` // Defaults to 1
+}
+
+// ParseSequence parses a JSON sequence definition into a Sequence. universes
+// maps the universe names used in the definition to the universe IDs of the
+// SequenceRunner which will run it. Effects are created from registry, or the
+// DefaultRegistry if nil
+func ParseSequence(data []byte, universes map[string]uint, registry *EffectRegistry) (*Sequence, error) {
+	var def SequenceDef
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil, err
+	}
+	return def.Build(universes, registry)
+}
+
+// Build creates a Sequence from the definition. See ParseSequence
+func (def *SequenceDef) Build(universes map[string]uint, registry *EffectRegistry) (*Sequence, error) {
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	seq := NewSequence()
+	groupNames := make([]string, 0, len(def.Groups))
+	for name := range def.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		ids, err := lookupUniverses(def.Groups[name], universes)
+		if err != nil {
+			return nil, fmt.Errorf("group \"%s\": %v", name, err)
+		}
+		seq.AddGroup(name, ids...)
+	}
+	for idx := range def.Steps {
+		stepDef := &def.Steps[idx]
+		if err := def.addSteps(seq, stepDef, universes, registry); err != nil {
+			return nil, fmt.Errorf("step %d (\"%s\"): %v", idx+1, stepDef.Name, err)
+		}
+	}
+	if err := checkNext(seq); err != nil {
+		return nil, err
+	}
+	for idx, opDef := range def.Initial {
+		op, err := opDef.build(seq, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("initial operation %d: %v", idx+1, err)
+		}
+		seq.AddInitialOperation(op)
+	}
+	return seq, nil
+}
+
+// addSteps adds the step, or a copy for each universe of its group, to seq
+func (def *SequenceDef) addSteps(seq *Sequence, stepDef *StepDef, universes map[string]uint, registry *EffectRegistry) error {
+	if stepDef.Name == "" {
+		return fmt.Errorf("step has no name")
+	}
+	blend, err := parseBlendMode(stepDef.Blend)
+	if err != nil {
+		return err
+	}
+
+	multi := stepDef.Group != "" || len(stepDef.Universes) > 0
+	if multi && (stepDef.ForEach != "" || stepDef.Universe != "") {
+		return fmt.Errorf("a step with a group or universes can't also have forEach or a universe")
+	}
+	var sub *Sequence
+	if stepDef.Sequence != nil {
+		if multi || stepDef.ForEach != "" || stepDef.Universe != "" || stepDef.Effect != "" {
+			return fmt.Errorf("a step with a sequence can't also have an effect or universes")
+		}
+		if sub, err = stepDef.Sequence.Build(universes, registry); err != nil {
+			return fmt.Errorf("sequence: %v", err)
+		}
+	}
+	if stepDef.Group != "" {
+		if _, ok := def.Groups[stepDef.Group]; !ok {
+			return fmt.Errorf("\"%s\" is not a known group", stepDef.Group)
+		}
+	}
+	multiIDs, err := lookupUniverses(stepDef.Universes, universes)
+	if err != nil {
+		return err
+	}
+	var stagger time.Duration
+	if stepDef.Stagger != nil {
+		if stagger, err = parseDuration(stepDef.Stagger); err != nil {
+			return fmt.Errorf("stagger: %v", err)
+		}
+	}
+	var instances InstanceMode
+	switch stepDef.Instances {
+	case "", "shared":
+		instances = SharedInstance
+	case "independent":
+		instances = IndependentInstances
+	default:
+		return fmt.Errorf("\"%s\" is not a known instance mode", stepDef.Instances)
+	}
+
+	group := []string{""}
+	universeName := stepDef.Universe
+	if stepDef.ForEach != "" {
+		var ok bool
+		if group, ok = def.Groups[stepDef.ForEach]; !ok || len(group) == 0 {
+			return fmt.Errorf("\"%s\" is not a known group", stepDef.ForEach)
+		}
+		if universeName == "" {
+			universeName = "{universe}"
+		}
+	}
+
+	for idx := range group {
+		var forEach []string
+		if stepDef.ForEach != "" {
+			forEach = group
+		}
+		name, err := expandTemplate(stepDef.Name, forEach, idx)
+		if err != nil {
+			return err
+		}
+		if _, exists := seq.steps[name]; exists {
+			return fmt.Errorf("duplicate step name \"%s\"", name)
+		}
+		var uniID uint
+		if !multi && sub == nil {
+			uniName, err := expandTemplate(universeName, forEach, idx)
+			if err != nil {
+				return err
+			}
+			var ok bool
+			if uniID, ok = universes[uniName]; !ok {
+				return fmt.Errorf("\"%s\" is not a known universe", uniName)
+			}
+		}
+		var effect Animation
+		if sub == nil {
+			if effect, err = registry.Create(stepDef.Effect, stepDef.Params); err != nil {
+				return err
+			}
+		}
+		step := &Step{
+			UniverseID:  uniID,
+			Effect:      effect,
+			Layer:       stepDef.Layer,
+			Blend:       blend,
+			Opacity:     stepDef.Opacity,
+			Group:       stepDef.Group,
+			Universes:   multiIDs,
+			Stagger:     stagger,
+			Instances:   instances,
+			SubSequence: sub,
+		}
+		if _, cloneable := effect.(Cloner); sub == nil && !cloneable {
+			// Each run of the step, and each independent instance, gets a new effect.
+			// Cloneable effects are cloned by the runner, so instances get random
+			// sources of their own; others are created afresh from the registry
+			effectName, params := stepDef.Effect, stepDef.Params
+			step.Factory = func() Animation {
+				// The parameters have already been checked, so this can't fail
+				effect, _ := registry.Create(effectName, params)
+				return effect
+			}
+		}
+		for _, opDef := range stepDef.Next {
+			op, err := opDef.build(nil, forEach, idx)
+			if err != nil {
+				return err
+			}
+			step.Next = append(step.Next, op)
+		}
+		if stepDef.Join != nil {
+			if step.Join, err = def.buildJoin(stepDef.Join, forEach, idx); err != nil {
+				return err
+			}
+		}
+		seq.AddStep(name, step)
+	}
+	return nil
+}
+
+// lookupUniverses maps universe names to IDs
+func lookupUniverses(names []string, universes map[string]uint) ([]uint, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(names))
+	for idx, name := range names {
+		id, ok := universes[name]
+		if !ok {
+			return nil, fmt.Errorf("\"%s\" is not a known universe", name)
+		}
+		ids[idx] = id
+	}
+	return ids, nil
+}
+
+// buildJoin creates a Join from the definition, for position idx of the
+// step's group
+func (def *SequenceDef) buildJoin(joinDef *JoinDef, group []string, idx int) (*Join, error) {
+	join := &Join{Count: joinDef.Count}
+	switch joinDef.Mode {
+	case "", "all":
+		join.Mode = JoinAll
+	case "any":
+		join.Mode = JoinAny
+	case "count":
+		join.Mode = JoinCount
+	default:
+		return nil, fmt.Errorf("\"%s\" is not a known join mode", joinDef.Mode)
+	}
+	if joinDef.Delay != nil {
+		delay, err := parseDuration(joinDef.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("join: %v", err)
+		}
+		join.Delay = delay
+	}
+	for _, stepName := range joinDef.Steps {
+		if joinDef.ForEach == "" {
+			name, err := expandTemplate(stepName, group, idx)
+			if err != nil {
+				return nil, err
+			}
+			join.Steps = append(join.Steps, name)
+			continue
+		}
+		joinGroup, ok := def.Groups[joinDef.ForEach]
+		if !ok || len(joinGroup) == 0 {
+			return nil, fmt.Errorf("\"%s\" is not a known group", joinDef.ForEach)
+		}
+		for joinIdx := range joinGroup {
+			name, err := expandTemplate(stepName, joinGroup, joinIdx)
+			if err != nil {
+				return nil, err
+			}
+			join.Steps = append(join.Steps, name)
+		}
+	}
+	return join, nil
+}
+
+// checkNext verifies that the steps named in 'next' operations and joins all
+// exist. It's run once all steps have been added
+func checkNext(seq *Sequence) error {
+	names := make([]string, 0, len(seq.steps))
+	for name := range seq.steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for idx := range seq.steps[name].Next {
+			for _, next := range seq.steps[name].Next[idx].stepNames() {
+				if _, exists := seq.steps[next]; !exists {
+					return fmt.Errorf("step \"%s\" is followed by unknown step \"%s\"", name, next)
+				}
+			}
+		}
+		if join := seq.steps[name].Join; join != nil {
+			for _, joined := range join.Steps {
+				if _, exists := seq.steps[joined]; !exists {
+					return fmt.Errorf("step \"%s\" joins unknown step \"%s\"", name, joined)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// build creates an Operation from the definition. If seq is provided, the step
+// must already exist in it
+func (opDef OperationDef) build(seq *Sequence, group []string, idx int) (Operation, error) {
+	var op Operation
+	var err error
+	expand := func(s string) string {
+		if err == nil && s != "" {
+			s, err = expandTemplate(s, group, idx)
+		}
+		return s
+	}
+	op.StepName = expand(opDef.Step)
+	op.Otherwise = expand(opDef.Otherwise)
+	for _, choiceDef := range opDef.Choices {
+		weight := 1.0
+		if choiceDef.Weight != nil {
+			weight = *choiceDef.Weight
+		}
+		op.Choices = append(op.Choices, Choice{StepName: expand(choiceDef.Step), Weight: weight})
+	}
+	if err != nil {
+		return Operation{}, err
+	}
+	name := op.StepName
+	if len(op.Choices) > 0 {
+		if name != "" {
+			return Operation{}, fmt.Errorf("an operation can't have both a step and choices")
+		}
+		name = op.Choices[0].StepName
+	}
+	if seq != nil {
+		for _, next := range op.stepNames() {
+			if _, exists := seq.steps[next]; !exists {
+				return Operation{}, fmt.Errorf("\"%s\" is not a known step", next)
+			}
+		}
+	}
+	if opDef.Delay != nil {
+		if op.Delay, err = parseDuration(opDef.Delay); err != nil {
+			return Operation{}, fmt.Errorf("operation on \"%s\": %v", name, err)
+		}
+	}
+	if opDef.If != nil {
+		if op.Condition, err = opDef.If.build(); err != nil {
+			return Operation{}, fmt.Errorf("operation on \"%s\": %v", name, err)
+		}
+	}
+	op.Limit = opDef.Limit
+	return op, nil
+}
+
+// build creates a Condition from the definition
+func (condDef *ConditionDef) build() (Condition, error) {
+	if condDef.Var == "" {
+		return nil, fmt.Errorf("condition has no variable")
+	}
+	switch {
+	case condDef.Equals != nil && condDef.AtLeast == nil && condDef.Below == nil:
+		return IfEquals(condDef.Var, condDef.Equals), nil
+	case condDef.Equals == nil && condDef.AtLeast != nil && condDef.Below == nil:
+		return IfAtLeast(condDef.Var, *condDef.AtLeast), nil
+	case condDef.Equals == nil && condDef.AtLeast == nil && condDef.Below != nil:
+		return IfBelow(condDef.Var, *condDef.Below), nil
+	}
+	return nil, fmt.Errorf("condition on \"%s\" should have one of equals, atLeast or below", condDef.Var)
+}
+
+var templateRegexp = regexp.MustCompile(`\{(i|universe)([+-][0-9]+)?\}`)
+
+// expandTemplate replaces placeholders in s for position idx of group. It's an
+// error to use placeholders without a group
+func expandTemplate(s string, group []string, idx int) (string, error) {
+	var err error
+	expanded := templateRegexp.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if group == nil {
+			err = fmt.Errorf("\"%s\" may only be used in steps with forEach", placeholder)
+			return placeholder
+		}
+		parts := templateRegexp.FindStringSubmatch(placeholder)
+		offset := 0
+		if parts[2] != "" {
+			offset, _ = strconv.Atoi(strings.TrimPrefix(parts[2], "+"))
+		}
+		pos := ((idx+offset)%len(group) + len(group)) % len(group)
+		if parts[1] == "i" {
+			return strconv.Itoa(pos)
+		}
+		return group[pos]
+	})
+	return expanded, err
+}
+
+func parseBlendMode(name string) (BlendMode, error) {
+	if name == "" {
+		return BlendNormal, nil
+	}
+	for mode := BlendNormal; mode <= BlendAlphaMask; mode++ {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return BlendNormal, fmt.Errorf("\"%s\" is not a known blend mode", name)
+}
+
+// TowerUniverses maps the names of the tower windows, as in Universes, to the
+// universe IDs used by the portal's SequenceRunner
+func TowerUniverses() map[string]uint {
+	universes := make(map[string]uint, numShaftWindows)
+	for name, u := range Universes {
+		if strings.HasPrefix(name, "towerLevel") {
+			universes[name] = uint(u.Index - numResos)
+		}
+	}
+	return universes
+}
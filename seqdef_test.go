@@ -0,0 +1,171 @@
+package animation
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ownedPortalDef = `{
+  "groups": {
+    "windows": ["towerLevel1Window1", "towerLevel1Window2", "towerLevel2Window1", "towerLevel2Window2"]
+  },
+  "steps": [
+    {
+      "name": "in{i}", "forEach": "windows",
+      "effect": "interpolateTo", "params": {"color": "#00ff00", "duration": "250ms"},
+      "next": [{"step": "solid{i}"}, {"step": "in{i+2}"}]
+    },
+    {
+      "name": "solid{i}", "forEach": "windows",
+      "effect": "timedSolid", "params": {"color": "#00ff00", "duration": 500},
+      "next": [{"step": "out{i}"}]
+    },
+    {
+      "name": "out{i}", "forEach": "windows",
+      "effect": "interpolateTo", "params": {"color": "#000000", "duration": "500ms", "easing": "easeOut"}
+    },
+    {
+      "name": "glow", "universe": "towerLevel8Window2", "layer": 1, "blend": "add", "opacity": 0.5,
+      "effect": "solid", "params": {"color": "#202020"}
+    }
+  ],
+  "initial": [{"step": "in0"}, {"step": "in1"}, {"step": "glow", "delay": "2s"}]
+}`
+
+func TestParseSequence(t *testing.T) {
+	seq, err := ParseSequence([]byte(ownedPortalDef), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(seq.steps) != 13 {
+		t.Fatalf("Expected 13 steps; got %d", len(seq.steps))
+	}
+	in3 := seq.steps["in3"]
+	if in3 == nil || in3.UniverseID != 3 {
+		t.Fatalf("in3 has unexpected universe: %+v", in3)
+	}
+	// {i+2} wraps around the group
+	if in3.Next[1].StepName != "in1" {
+		t.Fatalf("Expected in3 to be followed by in1; got %s", in3.Next[1].StepName)
+	}
+	glow := seq.steps["glow"]
+	if glow.UniverseID != 15 || glow.Layer != 1 || glow.Blend != BlendAdd || glow.Opacity != 0.5 {
+		t.Fatalf("glow step not as defined: %+v", glow)
+	}
+	if len(seq.initialOperations) != 3 || seq.initialOperations[2].Delay != 2*time.Second {
+		t.Fatalf("Unexpected initial operations %v", seq.initialOperations)
+	}
+	if seq.steps["solid0"].Effect == seq.steps["solid1"].Effect {
+		t.Fatalf("Repeated steps should have their own effect instances")
+	}
+	if out0 := seq.steps["out0"]; out0.instance() == out0.instance() {
+		t.Fatalf("Each run of a step should get a new effect instance")
+	}
+
+	sr := NewSequenceRunner([]uint{10, 10, 10, 10})
+	sr.InitSequence(seq, time.Now())
+	if done := sr.ProcessFrame(time.Now()); done {
+		t.Fatalf("Parsed sequence finished immediately")
+	}
+}
+
+func TestParseSequenceIndependentRandom(t *testing.T) {
+	def := `{
+	  "groups": {"windows": ["towerLevel1Window1", "towerLevel1Window2", "towerLevel2Window1", "towerLevel2Window2"]},
+	  "steps": [{
+	    "name": "sparkle", "group": "windows", "instances": "independent",
+	    "effect": "sparkle", "params": {"color": "#ffffff", "density": 0.5, "seed": 3}
+	  }],
+	  "initial": [{"step": "sparkle"}]
+	}`
+	seq, err := ParseSequence([]byte(def), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sr := NewSequenceRunner([]uint{32, 32, 32, 32})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	// Each instance has its own random source, so its own pattern
+	if fmt.Sprint(sr.UniverseData(0)) == fmt.Sprint(sr.UniverseData(1)) {
+		t.Fatalf("Independent instances show the same pattern")
+	}
+}
+
+func TestParseSequenceErrors(t *testing.T) {
+	cases := []struct {
+		def  string
+		want string
+	}{
+		{`{"steps": [`, "unexpected EOF"},
+		{"{\n\"steps\": []\n,}", "line 3"},
+		{`{"stepz": []}`, "unknown field"},
+		{`{"steps": [{"name": "a", "universe": "nowhere", "effect": "solid", "params": {"color": "#ffffff"}}]}`,
+			`step 1 ("a"): "nowhere" is not a known universe`},
+		{`{"steps": [{"name": "a{i}", "universe": "towerLevel1Window1", "effect": "solid", "params": {"color": "#ffffff"}}]}`,
+			"may only be used in steps with forEach"},
+		{`{"steps": [{"name": "a{i}", "forEach": "nope", "effect": "solid", "params": {"color": "#ffffff"}}]}`,
+			`"nope" is not a known group`},
+		{`{"steps": [{"name": "a", "universe": "towerLevel1Window1", "effect": "solid", "params": {"colour": "#ffffff"}}]}`,
+			`effect "solid": missing required parameter "color"`},
+		{`{"steps": [{"name": "a", "universe": "towerLevel1Window1", "effect": "solid", "params": {"color": "#ffffff"}, "next": [{"step": "b"}]}]}`,
+			`step "a" is followed by unknown step "b"`},
+		{`{"steps": [{"name": "a", "universe": "towerLevel1Window1", "effect": "solid", "blend": "overlay", "params": {"color": "#ffffff"}}]}`,
+			`"overlay" is not a known blend mode`},
+		{`{"steps": [], "initial": [{"step": "a"}]}`, `initial operation 1: "a" is not a known step`},
+	}
+	for _, c := range cases {
+		_, err := ParseSequence([]byte(c.def), TowerUniverses(), nil)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("Expected error containing %q for %s; got %v", c.want, c.def, err)
+		}
+	}
+}
+
+func TestTowerUniverses(t *testing.T) {
+	universes := TowerUniverses()
+	if len(universes) != numShaftWindows {
+		t.Fatalf("Expected %d tower universes; got %d", numShaftWindows, len(universes))
+	}
+	if universes["towerLevel1Window1"] != 0 || universes["towerLevel8Window2"] != numShaftWindows-1 {
+		t.Fatalf("Unexpected tower universe IDs %v", universes)
+	}
+}
+
+func TestParseSequenceJoin(t *testing.T) {
+	def := `{
+	  "groups": {"windows": ["towerLevel1Window1", "towerLevel1Window2", "towerLevel2Window1"]},
+	  "steps": [
+	    {"name": "fade{i}", "forEach": "windows", "effect": "interpolateTo", "params": {"color": "#000000", "duration": "1s"}},
+	    {"name": "flash{i}", "forEach": "windows", "effect": "flash", "params": {"color": "#ffffff"},
+	     "join": {"forEach": "windows", "steps": ["fade{i}"], "delay": 100}}
+	  ],
+	  "initial": [{"step": "fade0"}, {"step": "fade1"}, {"step": "fade2"}]
+	}`
+	seq, err := ParseSequence([]byte(def), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	join := seq.steps["flash1"].Join
+	if join == nil || join.Mode != JoinAll || join.Delay != 100*time.Millisecond ||
+		strings.Join(join.Steps, ",") != "fade0,fade1,fade2" {
+		t.Fatalf("Unexpected join %+v", join)
+	}
+	if err = seq.Validate(make([]uint, numShaftWindows)); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	flashes := 0
+	for _, e := range seq.Timeline(2 * time.Second) {
+		if strings.HasPrefix(e.Step, "flash") {
+			flashes++
+			if e.Start != 1100*time.Millisecond {
+				t.Fatalf("Expected flashes to start at 1.1s; got %+v", e)
+			}
+		}
+	}
+	if flashes != 3 {
+		t.Fatalf("Expected 3 flashes in the timeline; got %d", flashes)
+	}
+}
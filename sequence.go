@@ -7,26 +7,164 @@ import (
 	"fmt"
 	"image/color"
 	"log"
+	"math/rand"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
 
-// Operation is an operation to apply in order to orchestrate a sequence
+// Operation is an operation to apply in order to orchestrate a sequence.
+// Operations can branch: with a Condition, the operation only applies if the
+// runner's variables satisfy it; with Choices, the step started is chosen at
+// random; with a Limit, the operation only applies that many times in a row,
+// e.g. to go round a loop three times. When a condition fails or the limit is
+// reached, the Otherwise step is started instead, if there is one. Reaching the
+// limit starts the count again, so a loop inside a larger cycle goes round the
+// same number of times on each pass.
+// Since branching was added, Operation has more fields than StepName and
+// Delay, so unkeyed literals such as Operation{"step", delay} no longer
+// compile. Use field names, or NewOperation for a plain operation
 type Operation struct {
-	StepName string        // The name of the step to run next
-	Delay    time.Duration // Optional delay to apply before starting next step
+	StepName  string        // The name of the step to run next
+	Delay     time.Duration // Optional delay to apply before starting next step
+	Condition Condition     // Optional condition for the operation to apply
+	Choices   []Choice      // Steps to choose between at random, instead of StepName
+	Limit     int           // Maximum number of times the operation applies; zero for no limit
+	Otherwise string        // Step to start if the condition fails or the limit is reached
+}
+
+// NewOperation creates an operation starting the named step after delay, with
+// no branching
+func NewOperation(stepName string, delay time.Duration) Operation {
+	return Operation{StepName: stepName, Delay: delay}
 }
 
 // Step is a sequencing step. Contains information about the effect(s) to
 // perform and the universe[s] being targetted.
-// Can be gated on completion of another referenced step, and/or delayed by
-// an amount of time. If both gating step and delay are specified, the delay
-// will be applied after the gating step completes.
+// A step is started by an operation - an initial operation of the sequence,
+// or one in the Next list of another step, applied when that step completes.
+// Operations may be delayed by an amount of time. A step can also Join a set
+// of other steps, so that it starts once all (or some) of them have completed.
+// Steps render into a compositing layer of their universe. By default this is
+// the base layer (0); steps on higher layers are blended on top of the layers
+// beneath them, allowing several effects to contribute to a universe at once.
+// A step may target several universes, by listing them or naming a group of
+// universes in the sequence. It completes once it has completed on all of
+// them. The universes can share a single instance of the effect, keeping them
+// in sync, or each have their own instance.
+// Effect is a template: each time the step runs, it gets a fresh instance of
+// the effect, created by Factory if set, or else by cloning Effect if it's a
+// Cloner. Effects which can't be cloned are shared by every run of the step.
+// Instead of an effect, a step can run a whole sequence, its SubSequence. The
+// sub-sequence's universes are mapped onto those of the containing sequence
+// by UniverseMap, or failing that, by adding UniverseOffset. The step
+// completes when the sub-sequence does.
 type Step struct {
-	UniverseID uint        // The universe to which the step is applied
-	Effect     Animation   // The animation effect to play
-	Next       []Operation // An optional list of operations to apply after completion of this step
+	UniverseID     uint             // The universe to which the step is applied
+	Effect         Animation        // The animation effect to play, cloned for each run if it's a Cloner
+	Next           []Operation      // An optional list of operations to apply after completion of this step
+	Layer          int              // Compositing layer the step renders into; 0 is the base layer
+	Blend          BlendMode        // How the step's layer is blended onto those beneath. Ignored on the base layer
+	Opacity        float64          // Opacity of the step's layer, 0.0-1.0. Zero is treated as fully opaque
+	Join           *Join            // Optional set of steps whose completion starts this step
+	Universes      []uint           // Universes to apply the step to, instead of UniverseID
+	Group          string           // Group of universes (see Sequence.AddGroup) to apply the step to, instead of UniverseID
+	Stagger        time.Duration    // Delay before starting on each successive universe, for cascades
+	Instances      InstanceMode     // Whether the universes share an instance of the effect
+	Factory        func() Animation // Creates instances of the effect. If set, used instead of Effect
+	SubSequence    *Sequence        // Sequence to run instead of an effect
+	UniverseMap    map[uint]uint    // Universes of the containing sequence, by universe of the sub-sequence
+	UniverseOffset uint             // Offset added to sub-sequence universes not in UniverseMap
+}
+
+// InstanceMode determines how effect instances are used by a step targeting
+// several universes
+type InstanceMode int
+
+const (
+	// SharedInstance renders a single instance of the effect each frame, showing
+	// the same output on every universe. With a Stagger, each universe joins in
+	// showing the effect later than the one before
+	SharedInstance InstanceMode = iota
+	// IndependentInstances gives each universe its own instance of the effect,
+	// created by the step's Factory or by cloning its Effect. With a Stagger,
+	// each instance starts later than the one before
+	IndependentInstances
+)
+
+// instance gets an instance of the step's effect: a new one if possible,
+// otherwise the shared Effect
+func (s *Step) instance() Animation {
+	if s.Factory != nil {
+		return s.Factory()
+	}
+	return cloneEffect(s.Effect)
+}
+
+// fresh is whether the step gets a new instance of its effect each time one is
+// asked for
+func (s *Step) fresh() bool {
+	if s.Factory != nil {
+		return true
+	}
+	_, cloneable := s.Effect.(Cloner)
+	return cloneable
+}
+
+// template gets an effect representative of the step, for working out
+// durations and the like, without creating an instance if possible
+func (s *Step) template() Animation {
+	if s.Effect != nil {
+		return s.Effect
+	}
+	return s.instance()
+}
+
+// JoinMode determines how many of a Join's steps must complete
+type JoinMode int
+
+const (
+	// JoinAll waits for all the steps to complete
+	JoinAll JoinMode = iota
+	// JoinAny waits for any one of the steps to complete
+	JoinAny
+	// JoinCount waits for Count of the steps to complete
+	JoinCount
+)
+
+// Join starts a step once a set of other steps have completed, e.g. to flash
+// all windows once every window's fade-out has finished. Completions are
+// counted from the start of the sequence, or from when the join last started
+// its step, so a join in a cycle fires once per time around
+type Join struct {
+	Steps []string      // Names of the steps to wait for
+	Mode  JoinMode      // How many of them to wait for
+	Count int           // Number of steps to wait for, with JoinCount
+	Delay time.Duration // Optional delay to apply once the steps have completed
+}
+
+// needed gives the number of distinct steps which must complete
+func (j *Join) needed() int {
+	switch j.Mode {
+	case JoinAny:
+		return 1
+	case JoinCount:
+		return j.Count
+	}
+	return len(j.Steps)
+}
+
+// WhenAll sets the step to start once all the named steps have completed
+func (s *Step) WhenAll(stepNames ...string) *Step {
+	s.Join = &Join{Steps: stepNames, Mode: JoinAll}
+	return s
+}
+
+// WhenAny sets the step to start once any of the named steps completes
+func (s *Step) WhenAny(stepNames ...string) *Step {
+	s.Join = &Join{Steps: stepNames, Mode: JoinAny}
+	return s
 }
 
 // ThenDo adds a 'next' operation to a step
@@ -34,7 +172,7 @@ func (s *Step) ThenDo(stepName string, delay time.Duration) *Step {
 	if s.Next == nil {
 		s.Next = make([]Operation, 0)
 	}
-	s.Next = append(s.Next, Operation{stepName, delay})
+	s.Next = append(s.Next, Operation{StepName: stepName, Delay: delay})
 	return s
 }
 
@@ -45,13 +183,44 @@ func (s *Step) ThenDoImmediately(stepName string) *Step {
 
 // Sequence encapsulates an animation sequence
 type Sequence struct {
-	steps             map[string]*Step // Steps by name
-	initialOperations []Operation      // An initial set of operations to perform upon sequence start
+	steps             map[string]*Step  // Steps by name
+	initialOperations []Operation       // An initial set of operations to perform upon sequence start
+	groups            map[string][]uint // Named groups of universes, for steps to target
 }
 
 // NewSequence creates a new, empty sequence
 func NewSequence() *Sequence {
-	return &Sequence{make(map[string]*Step), make([]Operation, 0)}
+	return &Sequence{
+		steps:             make(map[string]*Step),
+		initialOperations: make([]Operation, 0),
+		groups:            make(map[string][]uint),
+	}
+}
+
+// AddGroup adds a named group of universes, which steps can target using their
+// Group field. Steps staggered across the group start on its universes in the
+// order given
+func (seq *Sequence) AddGroup(name string, universes ...uint) *Sequence {
+	seq.groups[name] = universes
+	return seq
+}
+
+// targets gets the universes targeted by a step
+func (seq *Sequence) targets(step *Step) []uint {
+	if step.SubSequence != nil {
+		children := step.SubSequence.universes()
+		for idx, child := range children {
+			children[idx] = step.parentUniverse(child)
+		}
+		return children
+	}
+	if step.Group != "" {
+		return seq.groups[step.Group]
+	}
+	if len(step.Universes) > 0 {
+		return step.Universes
+	}
+	return []uint{step.UniverseID}
 }
 
 // AddStep adds a step to the sequence
@@ -60,6 +229,18 @@ func (seq *Sequence) AddStep(name string, step *Step) *Sequence {
 	return seq
 }
 
+// SetStepEffect changes the effect of a step, which may be running. Runs of
+// the step already under way carry on with their own instances; the new effect
+// is used from the step's next run. Returns whether the step exists
+func (seq *Sequence) SetStepEffect(name string, effect Animation) bool {
+	step := seq.steps[name]
+	if step == nil {
+		return false
+	}
+	step.Effect = effect
+	return true
+}
+
 // AddInitialOperation adds an initial operation to the sequence
 func (seq *Sequence) AddInitialOperation(operation Operation) *Sequence {
 	seq.initialOperations = append(seq.initialOperations, operation)
@@ -70,7 +251,7 @@ func (seq *Sequence) AddInitialOperation(operation Operation) *Sequence {
 // to run immediately
 func (seq *Sequence) AddInitialStep(name string, step *Step) *Sequence {
 	seq.AddStep(name, step)
-	seq.AddInitialOperation(Operation{name, 0})
+	seq.AddInitialOperation(Operation{StepName: name})
 	return seq
 }
 
@@ -88,27 +269,87 @@ func (seq *Sequence) CreateStepCycle(names ...string) *Sequence {
 	return seq
 }
 
+// joinWaiters gives the names of the steps joining each step, indexed by the
+// name of the step joined
+func (seq *Sequence) joinWaiters() map[string][]string {
+	waiters := make(map[string][]string)
+	for name, step := range seq.steps {
+		if step != nil && step.Join != nil {
+			for _, joined := range step.Join.Steps {
+				waiters[joined] = append(waiters[joined], name)
+			}
+		}
+	}
+	for _, names := range waiters {
+		sort.Strings(names)
+	}
+	return waiters
+}
+
 /*
  * SequenceRunner
  */
 
-// Encapsulate a step waiting for another step to complete
+// Encapsulate a step waiting for a particular time
 type stepAndTime struct {
 	runAt time.Time
+	name  string
 	toRun *Step
 }
 
+// activation is a single run of a step, which may span several universes
+type activation struct {
+	name       string       // The name the step was started under
+	step       *Step        // The step being run
+	remaining  int          // Number of universes on which the step is yet to complete
+	shared     Animation    // Effect instance shared by all universes; nil if independent
+	sharedAt   time.Time    // Frame time at which the shared instance was last rendered
+	sharedBuf  []color.RGBA // Output of the shared instance, for copying to other universes
+	sharedDone bool         // Has the shared instance completed?
+}
+
+// activeStep is an activation of a step on one universe
+type activeStep struct {
+	*activation
+	effect  Animation // The effect instance for this universe
+	startAt time.Time // When the universe starts showing the effect, if staggered
+}
+
 // SequenceRunner is responsible for executing a given sequence
 type SequenceRunner struct {
-	awaitingTime     []stepAndTime    // Queue of steps waiting on a particular time
-	activeByUniverse map[uint][]*Step // Queue of steps that can be run on a particular universe. Only head of queue is processed
-	buffers          [][]color.RGBA   // Buffers to hold universe data
-	currSeq          Sequence         // Reference to currently-running sequence
+	awaitingTime     []stepAndTime              // Queue of steps waiting on a particular time
+	completing       []*activation              // Steps with nowhere to run, to complete at the next frame
+	activeByUniverse map[uint]layerStack        // Compositing layers for each universe, each with a queue of steps. Only head of each queue is processed
+	universeOrder    []uint                     // IDs of the universes in activeByUniverse, in order, so they're processed deterministically
+	buffers          map[uint][]color.RGBA      // Buffers to hold composited universe data
+	currSeq          Sequence                   // Reference to currently-running sequence
+	clock            Clock                      // Source of time for Tick
+	joinWaiters      map[string][]string        // Names of steps joining each step, by the name of the step joined
+	joinCompleted    map[string]map[string]bool // Steps completed towards each joining step's join, by name
+	seqStart         time.Time                  // Runner time at which the current sequence started
+	lastWall         time.Time                  // Time passed in for the last frame
+	lastRunner       time.Time                  // Runner time of the last frame
+	speed            float64                    // Rate at which runner time passes, relative to the time passed in
+	paused           bool                       // Is runner time standing still?
+	subscribers      []*Subscription            // Subscriptions to lifecycle events
+	seeking          bool                       // Fast-forwarding, so holding back events already sent?
+	seekFrom         time.Time                  // Runner time before seeking; events up to then have already been sent
+	seqCompleted     bool                       // Has the current sequence completed?
+	vars             Vars                       // Variables for operations' conditions
+	opCounts         map[*Operation]int         // Number of times operations with limits have applied
+	seeds            *rand.Rand                 // Source of seeds for each run of a sequence
+	runSeed          int64                      // Seed for the current run of the sequence
+	rng              *rand.Rand                 // Source of random choices for the current run
+	enclosing        map[*Sequence]bool         // Sequences this runner's sequence is running inside, as a sub-sequence
 	sync.Mutex
 }
 
 var logger = log.New(os.Stderr, "(SEQUENCE) ", 0)
 
+// defaultSeed seeds the random choices of runners until Seed is called, so
+// they're reproducible by default
+const defaultSeed = 1
+
 // NewSequenceRunner creates a SequenceRunner for the provided sequence with the
 // specified universe sizes. These size indicate the number of pixels in each
 // universe, with the universe ID being the index into the array. (Universe IDs
@@ -119,25 +360,85 @@ func NewSequenceRunner(universeSizes []uint) (sr *SequenceRunner) {
 		// Slices by default are initialized with a length of 0 and a capacity of 8 preventing
 		// downstream extensions
 		awaitingTime:     make([]stepAndTime, 0, 8),
-		activeByUniverse: make(map[uint][]*Step, 16),
-		buffers:          make([][]color.RGBA, len(universeSizes)),
+		activeByUniverse: make(map[uint]layerStack, 16),
+		buffers:          make(map[uint][]color.RGBA, len(universeSizes)),
+		clock:            SystemClock{},
+		speed:            1.0,
+		vars:             make(Vars),
+		seeds:            rand.New(rand.NewSource(defaultSeed)),
 	}
 
 	for i, size := range universeSizes {
-		sr.activeByUniverse[uint(i)] = make([]*Step, 0, 8)
-		// Create a slice filled with zero values
-		sr.buffers[i] = make([]color.RGBA, size)
+		sr.addUniverse(uint(i), size)
 	}
 
 	return sr
 }
 
-func (sr *SequenceRunner) startStep(step *Step) {
-	if _, isPresent := sr.activeByUniverse[step.UniverseID]; !isPresent {
-		sr.activeByUniverse[step.UniverseID] = make([]*Step, 0, 8)
+// addUniverse gives the runner a universe of the given size to render
+func (sr *SequenceRunner) addUniverse(universeID uint, size uint) {
+	sr.setLayers(universeID, newLayerStack(size))
+	// Create a slice filled with zero values
+	sr.buffers[universeID] = make([]color.RGBA, size)
+}
+
+// SetClock sets the clock used by Tick. The system clock is used by default
+func (sr *SequenceRunner) SetClock(clock Clock) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	sr.clock = clock
+}
+
+// Clock gets the clock used by Tick
+func (sr *SequenceRunner) Clock() Clock {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.clock
+}
+
+func (sr *SequenceRunner) startStep(name string, step *Step, now time.Time) {
+	targets := sr.currSeq.targets(step)
+	act := &activation{name: name, step: step, remaining: len(targets)}
+	sr.emit(Event{Type: StepStarted, Step: name, Universes: targets, At: now})
+	if len(targets) == 0 {
+		// Nowhere to run, so done at the next frame. Not straight away, or a cycle
+		// of such steps would recurse forever
+		sr.completing = append(sr.completing, act)
+		return
+	}
+	if step.SubSequence != nil {
+		if sr.enclosing[step.SubSequence] {
+			// Running it would run it again, without end
+			logger.Printf("Step %s runs a sequence it's part of. Skipping.\n", name)
+			sr.completing = append(sr.completing, act)
+			return
+		}
+		sr.startSubSequence(act, now)
+		return
+	}
+	independent := step.Instances == IndependentInstances && step.fresh()
+	if !independent {
+		act.shared = step.instance()
+		act.shared.Start(now)
+	}
+	for idx, universeID := range targets {
+		layers, isPresent := sr.activeByUniverse[universeID]
+		if !isPresent {
+			// Not a universe we have a buffer for, so nothing will be visible
+			layers = newLayerStack(0)
+		}
+		l := layers.get(step.Layer)
+		sr.setLayers(universeID, layers)
+		startAt := now.Add(time.Duration(idx) * step.Stagger)
+		effect := act.shared
+		if independent {
+			effect = step.instance()
+			effect.Start(startAt)
+		}
+		l.steps = append(l.steps, activeStep{act, effect, startAt})
 	}
-	step.Effect.Start(time.Now())
-	sr.activeByUniverse[step.UniverseID] = append(sr.activeByUniverse[step.UniverseID], step)
 }
 
 // InitSequence initializes the SequenceRunner with the provides sequence, to
@@ -147,51 +448,77 @@ func (sr *SequenceRunner) InitSequence(seq *Sequence, now time.Time) {
 	sr.Lock()
 	defer sr.Unlock()
 
+	now = sr.runnerTime(now)
+	if sr.currSeq.steps != nil && !sr.seqCompleted {
+		sr.emit(Event{Type: SequenceReplaced, At: now})
+	}
+	sr.runSeed = sr.seeds.Int63()
 	sr.initSequenceInternal(*seq, now)
 }
 
 func (sr *SequenceRunner) initSequenceInternal(seq Sequence, now time.Time) {
 	sr.currSeq = seq
+	sr.seqStart = now
+	sr.seqCompleted = false
+	sr.opCounts = make(map[*Operation]int)
+	sr.rng = rand.New(rand.NewSource(sr.runSeed))
 
 	// Clear structures, no need to leave old slice preallocations
 	// as all slices when initially created are automatically 8
 	// entries from a capacity perspective
 	sr.awaitingTime = sr.awaitingTime[:0]
-	for k, v := range sr.activeByUniverse {
-		sr.activeByUniverse[k] = v[:0]
+	sr.completing = nil
+	for _, universeID := range sr.universeOrder {
+		for _, l := range sr.activeByUniverse[universeID] {
+			l.steps = l.steps[:0]
+			l.renderedBy = nil
+		}
+	}
+
+	// Index the joins, so completions can be matched up with them quickly
+	sr.joinWaiters = seq.joinWaiters()
+	sr.joinCompleted = make(map[string]map[string]bool)
+	for _, waiters := range sr.joinWaiters {
+		for _, name := range waiters {
+			sr.joinCompleted[name] = make(map[string]bool)
+		}
 	}
 
 	// Process the initial operations, scheduling or starting steps
-	for _, operation := range seq.initialOperations {
-		err := sr.processOperation(operation, now)
+	for idx := range seq.initialOperations {
+		err := sr.processOperation(&seq.initialOperations[idx], now)
 		if err != nil {
 			logger.Println(err)
 		}
 	}
 }
 
-func (sr *SequenceRunner) processOperation(operation Operation, now time.Time) error {
-	step, isPresent := sr.currSeq.steps[operation.StepName]
+func (sr *SequenceRunner) processOperation(operation *Operation, now time.Time) error {
+	name, applies := sr.resolve(operation)
+	if !applies {
+		return nil
+	}
+	step, isPresent := sr.currSeq.steps[name]
 	if !isPresent {
-		return fmt.Errorf("WARNING: Could not find step %s specified by initial operation. This operation will be ignored", operation.StepName)
+		return fmt.Errorf("WARNING: Could not find step %s specified by initial operation. This operation will be ignored", name)
 	}
 	if operation.Delay > 0 {
-		sr.scheduleAt(step, now.Add(operation.Delay))
+		sr.scheduleAt(name, step, now, now.Add(operation.Delay))
 	} else {
-		sr.startStep(step)
+		sr.startStep(name, step, now)
 	}
 
 	return nil
 }
 
-func deleteStep(a []*Step, i int) []*Step {
+func deleteStep(a []activeStep, i int) []activeStep {
 	// SliceTricks has some gaps
 	if i == 0 && len(a) == 1 {
-		return []*Step{}
+		return []activeStep{}
 	}
 
 	copy(a[i:], a[i+1:])
-	a[len(a)-1] = nil
+	a[len(a)-1] = activeStep{}
 	return a[:len(a)-1]
 }
 
@@ -205,48 +532,39 @@ func deleteSAT(a []stepAndTime, i int) []stepAndTime {
 	return append(a[:i], a[i+1:]...)
 }
 
-func (sr *SequenceRunner) scheduleAt(s *Step, runAt time.Time) {
-	sr.awaitingTime = append(sr.awaitingTime, stepAndTime{runAt, s})
+func (sr *SequenceRunner) scheduleAt(name string, s *Step, now, runAt time.Time) {
+	sr.awaitingTime = append(sr.awaitingTime, stepAndTime{runAt, name, s})
+	sr.emit(Event{Type: OperationScheduled, Step: name, Universes: sr.currSeq.targets(s), At: now, RunAt: runAt})
 }
 
-// Check for steps that are waiting on another step to complete.
+// Handle completion of a step on all its universes, applying the operations
+// that follow it, including any joins it completes.
 // 'now' is the time that should be considered to be the current time
-//
-func (sr *SequenceRunner) handleStepComplete(completed *Step, now time.Time) {
-	uniSteps, isPresent := sr.activeByUniverse[completed.UniverseID]
-	if isPresent {
-		if len(uniSteps) > 0 && uniSteps[0] == completed {
-			sr.activeByUniverse[completed.UniverseID] = deleteStep(uniSteps, 0)
+func (sr *SequenceRunner) handleStepComplete(completed *activation, now time.Time) {
+	step := completed.step
+	sr.emit(Event{Type: StepCompleted, Step: completed.name, Universes: sr.currSeq.targets(step), At: now})
+	if step.Next != nil {
+		for idx := range step.Next {
+			err := sr.processOperation(&step.Next[idx], now)
+			if err != nil {
+				logger.Println(err)
+			}
 		}
 	}
 
-	if completed.Next != nil {
-		for _, operation := range completed.Next {
-			err := sr.processOperation(operation, now)
+	for _, waiter := range sr.joinWaiters[completed.name] {
+		join := sr.currSeq.steps[waiter].Join
+		done := sr.joinCompleted[waiter]
+		done[completed.name] = true
+		if len(done) >= join.needed() {
+			// Reset, so the join can fire again next time around
+			sr.joinCompleted[waiter] = make(map[string]bool)
+			err := sr.processOperation(&Operation{StepName: waiter, Delay: join.Delay}, now)
 			if err != nil {
 				logger.Println(err)
 			}
 		}
 	}
-
-	// for idx := 0; idx < len(sr.awaitingStep); {
-	// 	waiting := sr.awaitingStep[idx]
-	// 	if waiting.waitingOn == completed.StepID {
-	// 		s := waiting.toRun
-	// 		if s.Delay > 0 {
-	// 			// Schedule to run after delay
-	// 			runAt := now.Add(s.Delay)
-	// 			sr.scheduleAt(s, runAt)
-	// 		} else {
-	// 			// Run immediately
-	// 			sr.startStep(s)
-	// 		}
-	// 		// Delete this from the list of waiting steps (and don't increment index)
-	// 		sr.awaitingStep = deleteSAGS(sr.awaitingStep, idx)
-	// 	} else {
-	// 		idx++
-	// 	}
-	// }
 }
 
 // Check for any tasks that should run at this point
@@ -256,8 +574,7 @@ func (sr *SequenceRunner) checkScheduledTasks(now time.Time) {
 		waiting := sr.awaitingTime[idx]
 		if now.After(waiting.runAt) && waiting.toRun != nil {
 			// Time to run it!
-			s := waiting.toRun
-			sr.startStep(s)
+			sr.startStep(waiting.name, waiting.toRun, now)
 			// Delete this from the list of waiting steps (and don't increment index)
 			sr.awaitingTime = deleteSAT(sr.awaitingTime, idx)
 		} else {
@@ -269,35 +586,111 @@ func (sr *SequenceRunner) checkScheduledTasks(now time.Time) {
 // ProcessFrame generates frame data corresponding to the specified time (which
 // should be monotonically increasing with each call)
 // Return value indicates whether the sequence is complete.
+// Effects are run in runner time, which passes at the same rate as the time
+// passed in, unless the runner is paused, sped up or slowed down
 func (sr *SequenceRunner) ProcessFrame(now time.Time) (done bool) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.processFrameInternal(sr.runnerTime(now))
+}
 
+func (sr *SequenceRunner) processFrameInternal(now time.Time) (done bool) {
 	done = true
 	effectDone := false
 
-	sr.Lock()
-	defer sr.Unlock()
-
 	sr.checkScheduledTasks(now)
+	completing := sr.completing
+	sr.completing = nil
+	for _, act := range completing {
+		sr.handleStepComplete(act, now)
+	}
 
-	for universeID, universe := range sr.activeByUniverse {
-		if len(universe) > 0 {
-			// We have an active step on this universe
-			s := universe[0]
-			// ...so we're not done yet
-			done = false
-			// Process the animation for the universe, first clear the slice
-			if sr.buffers[universeID], effectDone = s.Effect.Frame(sr.buffers[universeID], now); effectDone {
-				sr.handleStepComplete(s, now)
+	// Universes are processed in order, so steps complete, and make random
+	// choices, in the same order every time
+	for _, universeID := range sr.universeOrder {
+		layers := sr.activeByUniverse[universeID]
+		for _, l := range layers {
+			l.renderedBy = nil
+			if len(l.steps) > 0 {
+				// We have an active step on this layer
+				s := l.steps[0]
+				// ...so we're not done yet
+				done = false
+				if now.Before(s.startAt) {
+					// Staggered, and not this universe's turn yet
+					continue
+				}
+				l.renderedBy = s.step
+				// Process the animation for the layer
+				if s.shared != nil {
+					effectDone = sr.renderShared(s.activation, l, now)
+				} else {
+					l.buf, effectDone = s.effect.Frame(l.buf, now)
+				}
+				if effectDone {
+					l.steps = deleteStep(l.steps, 0)
+					s.remaining--
+					if s.remaining == 0 {
+						sr.handleStepComplete(s.activation, now)
+					}
+				}
 			}
 		}
+		if buf, isPresent := sr.buffers[universeID]; isPresent {
+			layers.composite(buf)
+		}
 	}
 
 	// We are done if we procssed nothing and there are no more queued-up steps
-	seqDone := done && len(sr.awaitingTime) == 0
+	seqDone := done && len(sr.awaitingTime) == 0 && len(sr.completing) == 0
+	if seqDone && !sr.seqCompleted {
+		sr.seqCompleted = true
+		sr.emit(Event{Type: SequenceCompleted, At: now})
+	}
 
 	return seqDone
 }
 
+// setLayers sets the layers of a universe, keeping track of the order of the
+// universes. The order is replaced rather than updated, as it may be being
+// iterated over
+func (sr *SequenceRunner) setLayers(universeID uint, layers layerStack) {
+	if _, isPresent := sr.activeByUniverse[universeID]; !isPresent {
+		pos := sort.Search(len(sr.universeOrder), func(i int) bool { return sr.universeOrder[i] >= universeID })
+		order := make([]uint, 0, len(sr.universeOrder)+1)
+		order = append(order, sr.universeOrder[:pos]...)
+		order = append(order, universeID)
+		sr.universeOrder = append(order, sr.universeOrder[pos:]...)
+	}
+	sr.activeByUniverse[universeID] = layers
+}
+
+// renderShared renders a shared effect instance into the layer. The instance
+// is rendered once per frame, by the first universe to get to it; the others
+// copy its output
+func (sr *SequenceRunner) renderShared(act *activation, l *layer, now time.Time) (effectDone bool) {
+	if act.remaining == 1 && act.sharedBuf == nil {
+		// The only universe, so no copying needed
+		l.buf, act.sharedDone = act.shared.Frame(l.buf, now)
+		return act.sharedDone
+	}
+	if act.sharedBuf == nil || (!act.sharedAt.Equal(now) && !act.sharedDone) {
+		l.buf, act.sharedDone = act.shared.Frame(l.buf, now)
+		act.sharedAt = now
+		act.sharedBuf = append(act.sharedBuf[:0], l.buf...)
+	} else {
+		copy(l.buf, act.sharedBuf)
+	}
+	return act.sharedDone
+}
+
+// Tick generates frame data for the current time on the runner's clock. See
+// ProcessFrame
+func (sr *SequenceRunner) Tick() (done bool) {
+	return sr.ProcessFrame(sr.Clock().Now())
+}
+
 // UniverseData gets current data for the specified universe. This data is
 // updated by calling ProcessFrame for the universe
 func (sr *SequenceRunner) UniverseData(UniverseID uint) []color.RGBA {
@@ -306,3 +699,225 @@ func (sr *SequenceRunner) UniverseData(UniverseID uint) []color.RGBA {
 
 	return sr.buffers[UniverseID]
 }
+
+/*
+ * Runtime control - stopping and replacing steps without reinitializing the
+ * sequence. Cancelled steps don't complete, so their Next operations aren't
+ * applied and they don't count towards joins
+ */
+
+// CancelStep stops all running activations of the named step, on every
+// universe, along with any pending delayed starts of it. Returns whether
+// anything was cancelled
+func (sr *SequenceRunner) CancelStep(name string) bool {
+	sr.Lock()
+	defer sr.Unlock()
+
+	cancelled := sr.cancelScheduled(name) > 0
+	for _, universeID := range sr.universeOrder {
+		for _, l := range sr.activeByUniverse[universeID] {
+			if removeSteps(l, func(s activeStep) bool { return s.name == name }) > 0 {
+				cancelled = true
+			}
+		}
+	}
+	return cancelled
+}
+
+// CancelScheduled cancels pending delayed starts of the named step, leaving
+// any running activations of it alone. An empty name cancels all pending
+// starts. Returns the number cancelled
+func (sr *SequenceRunner) CancelScheduled(name string) int {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.cancelScheduled(name)
+}
+
+func (sr *SequenceRunner) cancelScheduled(name string) (count int) {
+	for idx := 0; idx < len(sr.awaitingTime); {
+		if name == "" || sr.awaitingTime[idx].name == name {
+			sr.awaitingTime = deleteSAT(sr.awaitingTime, idx)
+			count++
+		} else {
+			idx++
+		}
+	}
+	return count
+}
+
+// ClearUniverse stops everything running or queued on all layers of a
+// universe, and blanks it. Steps also running on other universes carry on
+// there, completing as normal
+func (sr *SequenceRunner) ClearUniverse(universeID uint) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	for _, l := range sr.activeByUniverse[universeID] {
+		removeSteps(l, func(activeStep) bool { return true })
+		l.renderedBy = nil
+		for idx := range l.buf {
+			l.buf[idx] = color.RGBA{}
+		}
+	}
+	for idx := range sr.buffers[universeID] {
+		sr.buffers[universeID][idx] = color.RGBA{}
+	}
+}
+
+// ReplaceEffect stops everything running or queued on the base layer of a
+// universe and plays effect there instead, starting at now. With a non-zero
+// crossfade, the universe fades from its current content to the new effect
+// over that time. Higher layers are left alone
+func (sr *SequenceRunner) ReplaceEffect(universeID uint, effect Animation, crossfade time.Duration, now time.Time) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	now = sr.runnerTime(now)
+	layers, isPresent := sr.activeByUniverse[universeID]
+	if !isPresent {
+		return
+	}
+	l := layers[0]
+	removeSteps(l, func(activeStep) bool { return true })
+	if crossfade > 0 {
+		effect = NewCrossfade(&heldFrame{append([]color.RGBA(nil), l.buf...)}, effect, crossfade)
+	}
+	effect.Start(now)
+	step := &Step{UniverseID: universeID, Effect: effect}
+	l.steps = append(l.steps, activeStep{&activation{step: step, remaining: 1}, effect, now})
+}
+
+// removeSteps removes the steps matching a predicate from a layer's queue,
+// returning the number removed. Activations spanning other universes are left
+// to complete on those
+func removeSteps(l *layer, match func(activeStep) bool) (count int) {
+	for idx := 0; idx < len(l.steps); {
+		if match(l.steps[idx]) {
+			l.steps[idx].remaining--
+			l.steps = deleteStep(l.steps, idx)
+			count++
+		} else {
+			idx++
+		}
+	}
+	return count
+}
+
+// heldFrame is an effect showing a fixed frame forever, e.g. the content of a
+// universe when its effect was replaced
+type heldFrame struct {
+	data []color.RGBA
+}
+
+func (h *heldFrame) Start(startTime time.Time) {}
+
+func (h *heldFrame) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	copy(buf, h.data)
+	return buf, false
+}
+
+/*
+ * Transport control - pausing, seeking and changing speed, e.g. for rehearsals.
+ * The runner keeps its own time, which advances from frame to frame by the
+ * time passed in, scaled by the speed, and stands still while paused. Changes
+ * take effect from the last frame processed
+ */
+
+// seekStep is the interval at which frames are rendered when fast-forwarding
+const seekStep = 20 * time.Millisecond
+
+// runnerTime advances runner time to correspond to now, returning it
+func (sr *SequenceRunner) runnerTime(now time.Time) time.Time {
+	if sr.lastWall.IsZero() {
+		// First time through: runner time starts out matching the time passed in
+		sr.lastWall, sr.lastRunner = now, now
+	}
+	if elapsed := now.Sub(sr.lastWall); elapsed > 0 && !sr.paused {
+		sr.lastRunner = sr.lastRunner.Add(scaleDuration(elapsed, sr.speed))
+	}
+	if now.After(sr.lastWall) {
+		sr.lastWall = now
+	}
+	return sr.lastRunner
+}
+
+// Pause stops runner time, freezing effects and scheduled operations
+func (sr *SequenceRunner) Pause() {
+	sr.Lock()
+	defer sr.Unlock()
+
+	sr.paused = true
+}
+
+// Resume restarts runner time after a pause, carrying on from where it stopped
+func (sr *SequenceRunner) Resume() {
+	sr.Lock()
+	defer sr.Unlock()
+
+	sr.paused = false
+}
+
+// Paused gets whether the runner is paused
+func (sr *SequenceRunner) Paused() bool {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.paused
+}
+
+// SetSpeed sets the rate at which runner time passes: 2.0 is double speed, 0.5
+// slow motion. Negative factors are treated as zero
+func (sr *SequenceRunner) SetSpeed(factor float64) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	if factor < 0 {
+		factor = 0
+	}
+	sr.speed = factor
+}
+
+// Speed gets the rate at which runner time passes
+func (sr *SequenceRunner) Speed() float64 {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.speed
+}
+
+// Position gets how far into the current sequence the runner is, in runner
+// time
+func (sr *SequenceRunner) Position() time.Duration {
+	sr.Lock()
+	defer sr.Unlock()
+
+	return sr.lastRunner.Sub(sr.seqStart)
+}
+
+// Seek moves to offset into the current sequence, forwards or backwards. The
+// sequence is restarted and fast-forwarded to the offset, rendering frames as
+// it goes so effects and steps end up as they would have been. Changes made to
+// running steps since the sequence started (cancellations, replacements) are
+// lost. Pausing and speed are unaffected. Events for the time passed over are
+// sent as it's fast-forwarded, with the times they'd have happened at, apart
+// from those up to the previous position, which have been sent already
+func (sr *SequenceRunner) Seek(offset time.Duration) {
+	sr.Lock()
+	defer sr.Unlock()
+
+	if offset < 0 {
+		offset = 0
+	}
+	start := sr.seqStart
+	target := start.Add(offset)
+	sr.seeking = true
+	sr.seekFrom = sr.lastRunner
+	sr.initSequenceInternal(sr.currSeq, start)
+	for t := start; t.Before(target); t = t.Add(seekStep) {
+		sr.processFrameInternal(t)
+	}
+	sr.processFrameInternal(target)
+	sr.seeking = false
+	sr.lastRunner = target
+}
@@ -36,16 +36,16 @@ func (a *multiRunAnimation) Frame(buf []color.RGBA, frameTime time.Time) (output
 }
 
 func TestDeleteStep(t *testing.T) {
-	s1 := Step{UniverseID: 1}
-	s2 := Step{UniverseID: 2}
-	s3 := Step{UniverseID: 3}
-	stepsArr := [3]*Step{&s1, &s2, &s3}
+	s1 := activeStep{activation: &activation{name: "s1", step: &Step{UniverseID: 1}}}
+	s2 := activeStep{activation: &activation{name: "s2", step: &Step{UniverseID: 2}}}
+	s3 := activeStep{activation: &activation{name: "s3", step: &Step{UniverseID: 3}}}
+	stepsArr := [3]activeStep{s1, s2, s3}
 	steps := stepsArr[:]
 	no0 := deleteStep(steps, 0)
-	if len(no0) != 2 || no0[0] != &s2 || no0[1] != &s3 {
+	if len(no0) != 2 || no0[0] != s2 || no0[1] != s3 {
 		t.Fatalf("Delete 0 not as expected: %v", no0)
 	}
-	if stepsArr != [3]*Step{&s2, &s3, nil} {
+	if stepsArr != [3]activeStep{s2, s3, {}} {
 		t.Fatalf("Underlying array not as expected after delete 0: %v", no0)
 	}
 }
@@ -190,7 +190,7 @@ func TestDelay(t *testing.T) {
 	ta2 := testAnimation(31)
 	s2 := &Step{UniverseID: 1, Effect: &ta2}
 	seq := NewSequence()
-	seq.AddStep("first", s1).AddInitialOperation(Operation{"first", 9 * time.Millisecond})
+	seq.AddStep("first", s1).AddInitialOperation(NewOperation("first", 9*time.Millisecond))
 	seq.AddInitialStep("second", s2)
 	sr := NewSequenceRunner([]uint{1, 6, 1, 10})
 	now := time.Unix(0, 0)
@@ -224,7 +224,7 @@ func TestDelay(t *testing.T) {
 func TestScheduleAfter(t *testing.T) {
 	ta1 := testAnimation(1)
 	ta2 := testAnimation(31)
-	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{Operation{"first", 1 * time.Millisecond}}}
+	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{NewOperation("first", 1*time.Millisecond)}}
 	// Not using a delay is dicey because the execution order in a single clock cycle
 	// is unpredictable
 	s1 := &Step{UniverseID: 1, Effect: &ta1}
@@ -273,7 +273,7 @@ func TestScheduleAfter(t *testing.T) {
 func TestScheduleAfterPlusDelay(t *testing.T) {
 	ta1 := testAnimation(1)
 	ta2 := testAnimation(31)
-	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{Operation{"s1", 2 * time.Millisecond}}}
+	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{NewOperation("s1", 2*time.Millisecond)}}
 	s1 := &Step{UniverseID: 1, Effect: &ta1}
 	seq := NewSequence()
 	seq.AddInitialStep("s2", s2)
@@ -310,7 +310,7 @@ func TestScheduleAfterBadStepId(t *testing.T) {
 	ta1 := testAnimation(1)
 	ta2 := testAnimation(31)
 	// Next operation with invalid step should be ignored with warning
-	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{Operation{"s9", 0}}}
+	s2 := &Step{UniverseID: 3, Effect: &ta2, Next: []Operation{NewOperation("s9", 0)}}
 	s1 := &Step{UniverseID: 1, Effect: &ta1}
 	seq := NewSequence().AddInitialStep("s2", s2).AddStep("s1", s1)
 	sr := NewSequenceRunner([]uint{1, 1, 1, 1})
@@ -338,3 +338,398 @@ func TestScheduleAfterBadStepId(t *testing.T) {
 		t.Fatal("Contingent effect ran")
 	}
 }
+
+func TestJoins(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewTimedSolid(black, 100*ms)}).
+		AddInitialStep("b", &Step{UniverseID: 1, Effect: NewTimedSolid(black, 200*ms)}).
+		AddInitialStep("c", &Step{UniverseID: 2, Effect: NewTimedSolid(black, 300*ms)}).
+		AddStep("all", (&Step{UniverseID: 3, Effect: NewTimedSolid(white, 50*ms)}).WhenAll("a", "b", "c")).
+		AddStep("any", (&Step{UniverseID: 4, Effect: NewTimedSolid(white, 50*ms)}).WhenAny("a", "b", "c")).
+		AddStep("two", &Step{UniverseID: 5, Effect: NewTimedSolid(white, 50*ms),
+			Join: &Join{Steps: []string{"a", "b", "c"}, Mode: JoinCount, Count: 2, Delay: 20 * ms}})
+	if err := seq.Validate(make([]uint, 6)); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	clock := NewManualClock(time.Unix(0, 0))
+	sr := NewSequenceRunner([]uint{1, 1, 1, 1, 1, 1})
+	sr.InitSequence(seq, clock.Now())
+	// Times at which each joining universe first shows white
+	firstWhite := make(map[uint]time.Duration)
+	for elapsed := time.Duration(0); elapsed <= 500*ms; elapsed += 10 * ms {
+		sr.ProcessFrame(clock.Now().Add(elapsed))
+		for u := uint(3); u <= 5; u++ {
+			if _, seen := firstWhite[u]; !seen && sr.UniverseData(u)[0] == white {
+				firstWhite[u] = elapsed
+			}
+		}
+	}
+	expected := map[uint][2]time.Duration{
+		3: {310 * ms, 320 * ms}, // After c completes at 310ms
+		4: {110 * ms, 120 * ms}, // After a completes at 110ms
+		5: {240 * ms, 250 * ms}, // 20ms after b completes at 210ms
+	}
+	for u, window := range expected {
+		if at, seen := firstWhite[u]; !seen || at < window[0] || at > window[1] {
+			t.Fatalf("Universe %d: expected join to start between %v and %v; started at %v (%v)", u, window[0], window[1], at, seen)
+		}
+	}
+}
+
+func TestJoinResets(t *testing.T) {
+	ms := time.Millisecond
+	// x cycles, but y runs once, so the join should only fire once
+	joined := multiRunAnimation(1)
+	seq := NewSequence().
+		AddInitialStep("x", &Step{UniverseID: 0, Effect: NewTimedSolid(black, 50*ms)}).
+		AddInitialStep("y", &Step{UniverseID: 1, Effect: NewTimedSolid(black, 50*ms)}).
+		AddStep("join", (&Step{UniverseID: 2, Effect: &joined}).WhenAll("x", "y")).
+		CreateStepCycle("x")
+
+	sr := NewSequenceRunner([]uint{1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	for elapsed := time.Duration(0); elapsed <= 500*ms; elapsed += 10 * ms {
+		sr.ProcessFrame(start.Add(elapsed))
+	}
+	// Each run of the join decrements the counter once
+	if joined != 0 {
+		t.Fatalf("Expected join to run once; counter is %d", joined)
+	}
+}
+
+// frameCounter counts the frames it renders, showing the count in the red
+// channel, and completes after a given number of frames
+type frameCounter struct {
+	frames, until int
+}
+
+func (fc *frameCounter) Start(startTime time.Time) {
+	fc.frames = 0
+}
+
+func (fc *frameCounter) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, done bool) {
+	fc.frames++
+	for idx := range buf {
+		buf[idx] = color.RGBA{uint8(fc.frames), 0, 0, 0xff}
+	}
+	return buf, fc.frames >= fc.until
+}
+
+func TestSharedInstanceStep(t *testing.T) {
+	counter := &frameCounter{until: 3}
+	seq := NewSequence().
+		AddGroup("all", 0, 1, 2).
+		AddInitialStep("shared", &Step{Group: "all", Effect: counter})
+	sr := NewSequenceRunner([]uint{2, 2, 2})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	for frame := 1; frame <= 3; frame++ {
+		done := sr.ProcessFrame(start.Add(time.Duration(frame) * time.Millisecond))
+		if counter.frames != frame {
+			t.Fatalf("Shared instance should render once per frame; rendered %d times in %d frames", counter.frames, frame)
+		}
+		for u := uint(0); u < 3; u++ {
+			if c := sr.UniverseData(u)[1]; c.R != uint8(frame) {
+				t.Fatalf("Frame %d: universe %d shows %v", frame, u, c)
+			}
+		}
+		if done {
+			t.Fatalf("Sequence finished early")
+		}
+	}
+	if done := sr.ProcessFrame(start.Add(4 * time.Millisecond)); !done {
+		t.Fatalf("Sequence should have finished once the step completed on all universes")
+	}
+}
+
+func TestStaggeredIndependentStep(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("wave", &Step{
+			Universes: []uint{0, 1, 2},
+			Instances: IndependentInstances,
+			Factory:   func() Animation { return NewTimedSolid(white, 100*ms) },
+			Stagger:   50 * ms,
+		}).
+		AddStep("after", &Step{UniverseID: 3, Effect: NewSolid(white)})
+	seq.steps["wave"].ThenDoImmediately("after")
+	if err := seq.Validate([]uint{1, 1, 1, 1}); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	sr := NewSequenceRunner([]uint{1, 1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	isLit := func(u uint) bool { return sr.UniverseData(u)[0] == white }
+	const (
+		dark = iota
+		lit
+	)
+	expected := []struct {
+		at    time.Duration
+		state [4]int
+	}{
+		{0, [4]int{lit, dark, dark, dark}},
+		{60 * ms, [4]int{lit, lit, dark, dark}},
+		{110 * ms, [4]int{lit, lit, lit, dark}},
+		{200 * ms, [4]int{lit, lit, lit, dark}},
+		// The last universe completes after 200ms, then the next step starts,
+		// rendering in the same frame, as its universe comes later
+		{210 * ms, [4]int{lit, lit, lit, lit}},
+		{220 * ms, [4]int{lit, lit, lit, lit}},
+	}
+	for _, e := range expected {
+		sr.ProcessFrame(start.Add(e.at))
+		for u := uint(0); u < 4; u++ {
+			if isLit(u) != (e.state[u] == lit) {
+				t.Fatalf("At %v: universe %d lit is %v", e.at, u, isLit(u))
+			}
+		}
+	}
+}
+
+func TestNowhereToRun(t *testing.T) {
+	// A cycle of steps targeting no universes completes a step each frame,
+	// rather than recursing forever
+	seq := NewSequence().
+		AddGroup("none").
+		AddInitialStep("empty", &Step{Group: "none", Effect: NewSolid(white)}).
+		AddStep("nested", &Step{SubSequence: NewSequence()})
+	seq.CreateStepCycle("empty", "nested")
+	sr := NewSequenceRunner([]uint{1})
+	events := sr.Subscribe(100)
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	for frame := 1; frame <= 4; frame++ {
+		if done := sr.ProcessFrame(start.Add(time.Duration(frame) * time.Millisecond)); done {
+			t.Fatalf("Cycle should never finish")
+		}
+	}
+	completed := 0
+	for len(events.Events) > 0 {
+		if ev := <-events.Events; ev.Type == StepCompleted {
+			completed++
+		}
+	}
+	if completed != 4 {
+		t.Fatalf("Expected a step to complete each frame; got %d in 4 frames", completed)
+	}
+}
+
+func TestCancelStep(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Universes: []uint{0, 1}, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("b", &Step{UniverseID: 2, Effect: NewSolid(white)}).
+		AddStep("c", &Step{UniverseID: 2, Effect: NewSolid(white)})
+	seq.steps["a"].ThenDoImmediately("b")
+	seq.AddInitialOperation(Operation{StepName: "c", Delay: 50 * ms})
+
+	sr := NewSequenceRunner([]uint{1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	if !sr.CancelStep("a") || sr.CancelStep("a") {
+		t.Fatal("Expected a to be cancelled once")
+	}
+	if sr.CancelScheduled("c") != 1 {
+		t.Fatal("Expected the delayed start of c to be cancelled")
+	}
+	for elapsed := 10 * ms; elapsed <= 200*ms; elapsed += 10 * ms {
+		if done := sr.ProcessFrame(start.Add(elapsed)); !done {
+			t.Fatalf("At %v: expected sequence to be done", elapsed)
+		}
+	}
+	// a was cancelled, not completed, so b never ran
+	if c := sr.UniverseData(2)[0]; c == white {
+		t.Fatal("Cancelled step's next step was run")
+	}
+}
+
+func TestClearUniverse(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{Universes: []uint{0, 1}, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("b", &Step{UniverseID: 2, Effect: NewSolid(white)})
+	seq.steps["a"].ThenDoImmediately("b")
+
+	sr := NewSequenceRunner([]uint{1, 1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	sr.ClearUniverse(0)
+	if c := sr.UniverseData(0)[0]; c != (color.RGBA{}) {
+		t.Fatalf("Expected cleared universe to be blank; got %v", c)
+	}
+	for elapsed := 10 * ms; elapsed <= 130*ms; elapsed += 10 * ms {
+		sr.ProcessFrame(start.Add(elapsed))
+		if c := sr.UniverseData(0)[0]; c != (color.RGBA{}) {
+			t.Fatalf("At %v: expected cleared universe to stay blank; got %v", elapsed, c)
+		}
+	}
+	// a carried on on universe 1, so completed there and started b
+	if c := sr.UniverseData(2)[0]; c != white {
+		t.Fatal("Expected b to run after a completed on the remaining universe")
+	}
+}
+
+func TestReplaceEffect(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewSolid(black)}).
+		AddStep("b", &Step{UniverseID: 0, Effect: NewSolid(black)})
+	seq.steps["a"].ThenDoImmediately("b")
+
+	sr := NewSequenceRunner([]uint{1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	sr.ReplaceEffect(0, NewTimedSolid(white, 100*ms), 20*ms, start)
+	expected := []struct {
+		at   time.Duration
+		red  uint8
+		done bool
+	}{
+		{10 * ms, 0x80, false},
+		{20 * ms, 0xff, false},
+		{100 * ms, 0xff, false},
+		{110 * ms, 0xff, false}, // Replacement completes
+		{120 * ms, 0xff, true},
+	}
+	for _, e := range expected {
+		done := sr.ProcessFrame(start.Add(e.at))
+		if c := sr.UniverseData(0)[0]; c.R != e.red || done != e.done {
+			t.Fatalf("At %v: expected red %#x, done %v; got %v, done %v", e.at, e.red, e.done, c, done)
+		}
+	}
+}
+
+func TestFreshInstances(t *testing.T) {
+	ms := time.Millisecond
+	fade := NewInterpolateSolid(black, white, 100*ms)
+	seq := NewSequence().
+		AddInitialStep("fade", &Step{Universes: []uint{0, 1}, Instances: IndependentInstances, Stagger: 50 * ms, Effect: fade})
+	if err := seq.Validate(nil); err != nil {
+		t.Fatalf("Cloneable effect should do for independent instances: %v", err)
+	}
+
+	sr := NewSequenceRunner([]uint{1, 1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	expected := []struct {
+		at     time.Duration
+		u0, u1 uint8
+	}{
+		{50 * ms, 0x80, 0x00},
+		{100 * ms, 0xff, 0x80},
+	}
+	for _, e := range expected {
+		sr.ProcessFrame(start.Add(e.at))
+		if u0, u1 := sr.UniverseData(0)[0].R, sr.UniverseData(1)[0].R; u0 != e.u0 || u1 != e.u1 {
+			t.Fatalf("At %v: expected red %#x, %#x; got %#x, %#x", e.at, e.u0, e.u1, u0, u1)
+		}
+	}
+	if !fade.startTime.IsZero() {
+		t.Fatalf("Step's effect should only be used as a template")
+	}
+}
+
+func TestSetStepEffect(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("hold", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)})
+	seq.steps["hold"].ThenDoImmediately("hold")
+
+	sr := NewSequenceRunner([]uint{1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+	if !seq.SetStepEffect("hold", NewTimedSolid(black, 100*ms)) {
+		t.Fatalf("Step not found")
+	}
+	if seq.SetStepEffect("missing", NewSolid(black)) {
+		t.Fatalf("Missing step should not be found")
+	}
+	// The running activation carries on as it started; the next run uses the new
+	// effect
+	sr.ProcessFrame(start.Add(80 * ms))
+	if c := sr.UniverseData(0)[0]; c.R != 0xff {
+		t.Fatalf("Running activation should be unaffected; got %v", c)
+	}
+	sr.ProcessFrame(start.Add(110 * ms))
+	sr.ProcessFrame(start.Add(150 * ms))
+	if c := sr.UniverseData(0)[0]; c.R != 0x00 {
+		t.Fatalf("Next run should use the new effect; got %v", c)
+	}
+}
+
+func TestPauseAndSpeed(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("fade", &Step{UniverseID: 0, Effect: NewInterpolateSolid(black, white, 100*ms)})
+
+	sr := NewSequenceRunner([]uint{1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	expected := []struct {
+		at     time.Duration
+		action func()
+		pos    time.Duration
+	}{
+		{0, nil, 0},
+		{20 * ms, sr.Pause, 20 * ms},
+		{50 * ms, sr.Resume, 20 * ms}, // Stood still while paused
+		{60 * ms, func() { sr.SetSpeed(0.5) }, 30 * ms},
+		{100 * ms, func() { sr.SetSpeed(2.0) }, 50 * ms},
+		{110 * ms, nil, 70 * ms},
+	}
+	for _, e := range expected {
+		sr.ProcessFrame(start.Add(e.at))
+		if pos := sr.Position(); pos != e.pos {
+			t.Fatalf("At %v: expected position %v; got %v", e.at, e.pos, pos)
+		}
+		// The fade is driven by runner time
+		if red, want := int(sr.UniverseData(0)[0].R), int(0xff*e.pos/(100*ms)); red < want-1 || red > want+1 {
+			t.Fatalf("At %v: expected red around %#x; got %#x", e.at, want, red)
+		}
+		if e.action != nil {
+			e.action()
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	ms := time.Millisecond
+	seq := NewSequence().
+		AddInitialStep("a", &Step{UniverseID: 0, Effect: NewTimedSolid(white, 100*ms)}).
+		AddStep("b", &Step{UniverseID: 0, Effect: NewInterpolateSolid(black, white, 100*ms)})
+	seq.steps["a"].ThenDo("b", 50*ms)
+
+	sr := NewSequenceRunner([]uint{1})
+	start := time.Unix(0, 0)
+	sr.InitSequence(seq, start)
+	sr.ProcessFrame(start)
+
+	// Fast-forwarding renders frames every 20ms, so a completes in the 120ms
+	// frame, and b starts in the 180ms frame
+	sr.Seek(200 * ms)
+	if pos := sr.Position(); pos != 200*ms {
+		t.Fatalf("Expected position 200ms after seeking; got %v", pos)
+	}
+	if red := sr.UniverseData(0)[0].R; red != 0x33 {
+		t.Fatalf("Expected b to be part way through after seeking; red is %#x", red)
+	}
+	// Time carries on from the new position
+	sr.ProcessFrame(start.Add(40 * ms))
+	if pos := sr.Position(); pos != 240*ms {
+		t.Fatalf("Expected position 240ms; got %v", pos)
+	}
+	// ...and back again
+	sr.Seek(50 * ms)
+	if c := sr.UniverseData(0)[0]; c != white {
+		t.Fatalf("Expected a to be showing after seeking back; got %v", c)
+	}
+}
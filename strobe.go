@@ -0,0 +1,162 @@
+package animation
+
+// Strobe and flash effects. Note that the portal's SafetyGovernor limits how
+// rapidly these can actually flash once rendered
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Strobe flashes a color on and off at a fixed frequency, with black between
+// flashes
+type Strobe struct {
+	color     color.RGBA
+	period    time.Duration
+	onTime    time.Duration
+	startTime time.Time
+}
+
+// NewStrobe creates a Strobe effect flashing at frequency (Hz). duty is the
+// fraction, 0.0-1.0, of each cycle for which the color is on
+func NewStrobe(c color.RGBA, frequency, duty float64) *Strobe {
+	period := time.Duration(float64(time.Second) / frequency)
+	return &Strobe{color: c, period: period, onTime: scaleDuration(period, duty)}
+}
+
+// Start sets the start time of the Strobe effect
+func (effect *Strobe) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *Strobe) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the Strobe effect. It never completes
+func (effect *Strobe) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	c := color.RGBA{0, 0, 0, 0xff}
+	if effect.period > 0 && frameTime.Sub(effect.startTime)%effect.period < effect.onTime {
+		c = effect.color
+	}
+	for idx := range buf {
+		buf[idx] = c
+	}
+	return buf, false
+}
+
+// Flash is a single flash of color, which decays to black
+type Flash struct {
+	color     color.RGBA
+	duration  time.Duration
+	startTime time.Time
+}
+
+// NewFlash creates a Flash effect, decaying over duration
+func NewFlash(c color.RGBA, duration time.Duration) *Flash {
+	return &Flash{color: c, duration: duration}
+}
+
+// Start sets the start time of the Flash effect
+func (effect *Flash) Start(startTime time.Time) {
+	effect.startTime = startTime
+}
+
+// Clone creates an unstarted copy of the effect
+func (effect *Flash) Clone() Animation {
+	c := *effect
+	return &c
+}
+
+// Frame creates a frame of the Flash effect. It completes once it has decayed
+func (effect *Flash) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(effect.startTime)
+	if elapsed > effect.duration {
+		return buf, true
+	}
+	// Quadratic decay looks more like a real flash than linear
+	remaining := 1.0 - float64(elapsed)/float64(effect.duration)
+	c := scaleColor(effect.color, remaining*remaining)
+	for idx := range buf {
+		buf[idx] = c
+	}
+	return buf, false
+}
+
+// Duration gives the time taken for the flash to decay
+func (effect *Flash) Duration() time.Duration {
+	return effect.duration
+}
+
+// Lightning is a short burst of irregular, bright flickers
+type Lightning struct {
+	color     color.RGBA
+	duration  time.Duration
+	rng       *rand.Rand
+	startTime time.Time
+	strikes   []time.Duration // Offsets from start of each flicker
+}
+
+const (
+	lightningMinStrikes  = 2
+	lightningMaxStrikes  = 4
+	lightningStrikeDecay = 120 * time.Millisecond
+)
+
+// NewLightning creates a Lightning effect lasting duration
+func NewLightning(c color.RGBA, duration time.Duration, rng *rand.Rand) *Lightning {
+	return &Lightning{color: c, duration: duration, rng: rng}
+}
+
+// Start sets the start time of the Lightning effect, and picks when the
+// flickers happen
+func (effect *Lightning) Start(startTime time.Time) {
+	effect.startTime = startTime
+	count := lightningMinStrikes + effect.rng.Intn(lightningMaxStrikes-lightningMinStrikes+1)
+	effect.strikes = make([]time.Duration, count)
+	// The first strike is always immediate
+	for idx := 1; idx < count; idx++ {
+		effect.strikes[idx] = time.Duration(effect.rng.Int63n(int64(effect.duration)/2 + 1))
+	}
+	sort.Slice(effect.strikes, func(i, j int) bool { return effect.strikes[i] < effect.strikes[j] })
+}
+
+// Clone creates an unstarted copy of the effect, with a random source of its
+// own seeded from this one's
+func (effect *Lightning) Clone() Animation {
+	c := *effect
+	c.rng = forkRand(effect.rng)
+	c.strikes = nil
+	return &c
+}
+
+// Frame creates a frame of the Lightning effect. It completes after duration
+func (effect *Lightning) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	elapsed := frameTime.Sub(effect.startTime)
+	if elapsed > effect.duration {
+		return buf, true
+	}
+	// Brightness is that of the most recent strike, decaying exponentially
+	brightness := 0.0
+	for _, strike := range effect.strikes {
+		if strike > elapsed {
+			break
+		}
+		brightness = math.Exp(-float64(elapsed-strike) / float64(lightningStrikeDecay) * 3.0)
+	}
+	c := scaleColor(effect.color, brightness)
+	for idx := range buf {
+		buf[idx] = c
+	}
+	return buf, false
+}
+
+// Duration gives the length of the Lightning effect
+func (effect *Lightning) Duration() time.Duration {
+	return effect.duration
+}
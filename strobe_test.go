@@ -0,0 +1,75 @@
+package animation
+
+import (
+	"fmt"
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestStrobe(t *testing.T) {
+	effect := NewStrobe(white, 10.0, 0.25)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	for _, c := range []struct {
+		at       time.Duration
+		expected color.RGBA
+	}{
+		{0, white},
+		{20 * time.Millisecond, white},
+		{30 * time.Millisecond, black},
+		{90 * time.Millisecond, black},
+		{100 * time.Millisecond, white},
+	} {
+		if out, done := effect.Frame(buf, now.Add(c.at)); out[0] != c.expected || done {
+			t.Fatalf("At %v expected %v, got %v (done %v)", c.at, c.expected, out[0], done)
+		}
+	}
+}
+
+func TestFlash(t *testing.T) {
+	effect := NewFlash(white, 200*time.Millisecond)
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	if out, _ := effect.Frame(buf, now); out[0] != white {
+		t.Fatalf("Flash didn't start at full brightness: %v", out[0])
+	}
+	if out, _ := effect.Frame(buf, now.Add(100*time.Millisecond)); out[0].R != 0x40 {
+		t.Fatalf("Flash not decayed halfway through: %v", out[0])
+	}
+	if _, done := effect.Frame(buf, now.Add(201*time.Millisecond)); !done {
+		t.Fatal("Flash not done after duration")
+	}
+}
+
+func TestLightning(t *testing.T) {
+	effect := NewLightning(white, time.Second, rand.New(rand.NewSource(1)))
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	buf := make([]color.RGBA, 1)
+	if out, _ := effect.Frame(buf, now); out[0] != white {
+		t.Fatalf("Lightning didn't strike immediately: %v", out[0])
+	}
+	if _, done := effect.Frame(buf, now.Add(time.Second+time.Millisecond)); !done {
+		t.Fatal("Lightning not done after duration")
+	}
+}
+
+func TestLightningClone(t *testing.T) {
+	now := time.Unix(0, 0)
+	template := NewLightning(white, time.Second, rand.New(rand.NewSource(1)))
+	first := template.Clone().(*Lightning)
+	second := template.Clone().(*Lightning)
+	// Starting the second clone doesn't affect the strikes of the first
+	second.Start(now)
+	first.Start(now)
+
+	again := NewLightning(white, time.Second, rand.New(rand.NewSource(1))).Clone().(*Lightning)
+	again.Start(now)
+	if fmt.Sprint(first.strikes) != fmt.Sprint(again.strikes) {
+		t.Fatalf("Clones should be reproducible; got strikes %v then %v", first.strikes, again.strikes)
+	}
+}
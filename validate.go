@@ -0,0 +1,321 @@
+package animation
+
+// Static checks on sequences, to find problems before they show up at runtime
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SequenceProblem describes a problem found in a sequence
+type SequenceProblem struct {
+	Step    string // Name of the step with the problem; empty for problems with the sequence as a whole
+	Message string
+}
+
+func (p SequenceProblem) String() string {
+	if p.Step == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("step \"%s\": %s", p.Step, p.Message)
+}
+
+// ValidationError is returned by Sequence.Validate, listing the problems found
+type ValidationError []SequenceProblem
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for idx, p := range e {
+		msgs[idx] = p.String()
+	}
+	return fmt.Sprintf("%d problem(s) in sequence: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Validate checks the sequence for problems:
+//   - operations and joins referring to steps that don't exist, and joins
+//     waiting for more steps than they list
+//   - steps that can never be reached from the initial operations
+//   - steps targeting universes outside universeSizes, the universe sizes the
+//     sequence will be run with (as passed to NewSequenceRunner). If nil, this
+//     check is skipped
+//   - steps targeting groups of universes that don't exist, or are empty
+//   - steps with no effect, or with independent instances but no way to
+//     create them
+//   - problems in sub-sequences, and sub-sequences which contain themselves
+//   - the same Step added under several names, or the same effect instance
+//     (one which can't be cloned) used by steps which may run at the same time
+//   - cycles of steps which complete immediately, linked with no delay, which
+//     would spin forever
+//
+// It returns nil if no problems are found, or a ValidationError otherwise
+func (seq *Sequence) Validate(universeSizes []uint) error {
+	var problems ValidationError
+	report := func(step, format string, args ...interface{}) {
+		problems = append(problems, SequenceProblem{step, fmt.Sprintf(format, args...)})
+	}
+
+	names := make([]string, 0, len(seq.steps))
+	for name := range seq.steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Missing references, and reachability. Joining steps are reachable once
+	// enough of the steps they join are
+	joinWaiters := seq.joinWaiters()
+	joinReached := make(map[string]int)
+	reachable := make(map[string]bool)
+	toVisit := make([]string, 0, len(seq.initialOperations))
+	for idx := range seq.initialOperations {
+		for _, next := range seq.initialOperations[idx].stepNames() {
+			if _, exists := seq.steps[next]; !exists {
+				report("", "initial operation refers to unknown step \"%s\"", next)
+				continue
+			}
+			toVisit = append(toVisit, next)
+		}
+	}
+	for len(toVisit) > 0 {
+		name := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+		if reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		if step := seq.steps[name]; step != nil {
+			for idx := range step.Next {
+				for _, next := range step.Next[idx].stepNames() {
+					if _, exists := seq.steps[next]; exists {
+						toVisit = append(toVisit, next)
+					}
+				}
+			}
+		}
+		for _, waiter := range joinWaiters[name] {
+			joinReached[waiter]++
+			if joinReached[waiter] == seq.steps[waiter].Join.needed() {
+				toVisit = append(toVisit, waiter)
+			}
+		}
+	}
+
+	namesByStep := make(map[*Step][]string)
+	type effectUse struct {
+		name string
+		step *Step
+	}
+	usesByEffect := make(map[Animation][]effectUse)
+	for _, name := range names {
+		step := seq.steps[name]
+		if step == nil {
+			report(name, "step is nil")
+			continue
+		}
+		for idx := range step.Next {
+			for _, next := range step.Next[idx].stepNames() {
+				if _, exists := seq.steps[next]; !exists {
+					report(name, "followed by unknown step \"%s\"", next)
+				}
+			}
+		}
+		if join := step.Join; join != nil {
+			for _, joined := range join.Steps {
+				if _, exists := seq.steps[joined]; !exists {
+					report(name, "joins unknown step \"%s\"", joined)
+				}
+			}
+			if needed := join.needed(); needed < 1 || needed > len(join.Steps) {
+				report(name, "join waits for %d of %d steps", needed, len(join.Steps))
+			}
+		}
+		if !reachable[name] {
+			report(name, "can never be reached from the initial operations")
+		}
+		if step.Group != "" {
+			if universes, exists := seq.groups[step.Group]; !exists {
+				report(name, "targets unknown group \"%s\"", step.Group)
+			} else if len(universes) == 0 {
+				report(name, "targets empty group \"%s\"", step.Group)
+			}
+		}
+		for _, universeID := range seq.targets(step) {
+			if universeSizes != nil && int(universeID) >= len(universeSizes) {
+				report(name, "targets universe %d, but there are only %d universes", universeID, len(universeSizes))
+			}
+		}
+		if step.Instances == IndependentInstances && !step.fresh() {
+			report(name, "has independent instances, but no Factory or cloneable effect to create them")
+		}
+		if step.SubSequence != nil {
+			if step.SubSequence.contains(seq) {
+				report(name, "runs a sub-sequence containing this sequence")
+			} else if err := step.SubSequence.Validate(nil); err != nil {
+				for _, problem := range err.(ValidationError) {
+					report(name, "sub-sequence: %s", problem)
+				}
+			}
+		} else if step.Effect == nil {
+			if step.Factory == nil {
+				report(name, "has no effect")
+			}
+		} else if !step.fresh() && reflect.ValueOf(step.Effect).Kind() == reflect.Ptr {
+			// Only effects held by pointer can be shared instances, and cloned
+			// effects never are
+			usesByEffect[step.Effect] = append(usesByEffect[step.Effect], effectUse{name, step})
+		}
+		namesByStep[step] = append(namesByStep[step], name)
+	}
+
+	// Sharing
+	for _, name := range names {
+		step := seq.steps[name]
+		if others := namesByStep[step]; step != nil && len(others) > 1 && others[0] == name {
+			report(name, "the same step is also added as %s", quoteAll(others[1:]))
+		}
+		if step == nil || step.Effect == nil {
+			continue
+		}
+		// Steps on the same universes and layer are queued, so can safely share an
+		// effect; elsewhere they might be running at the same time
+		for _, use := range usesByEffect[step.Effect] {
+			if use.name > name && use.step != step &&
+				(!sameUniverses(seq.targets(use.step), seq.targets(step)) || use.step.Layer != step.Layer) {
+				report(name, "shares its effect instance with step \"%s\", which may run at the same time", use.name)
+			}
+		}
+	}
+
+	// Zero-delay cycles of steps which complete immediately
+	for _, cycle := range seq.instantCycles(names, joinWaiters) {
+		report("", "steps %s form a cycle which never yields", quoteAll(cycle))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// instantCycles finds cycles of steps which take no time, linked by operations
+// or joins with no delay
+func (seq *Sequence) instantCycles(names []string, joinWaiters map[string][]string) [][]string {
+	instant := func(name string) bool {
+		step := seq.steps[name]
+		if step == nil {
+			return false
+		}
+		if len(seq.targets(step)) == 0 {
+			// Nowhere to run, e.g. an empty group or sub-sequence, so done at once
+			return true
+		}
+		if step.Effect == nil && step.Factory == nil {
+			return false
+		}
+		d, known := DurationOf(step.template())
+		return known && d == 0
+	}
+
+	const (
+		unvisited = iota
+		inProgress
+		finished
+	)
+	state := make(map[string]int)
+	var cycles [][]string
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = inProgress
+		path = append(path, name)
+		// Operations with limits can only go round a cycle so many times in a row,
+		// so only their alternative counts
+		var next []string
+		for _, op := range seq.steps[name].Next {
+			if op.Delay > 0 {
+				continue
+			}
+			if op.Limit > 0 {
+				if op.Otherwise != "" {
+					next = append(next, op.Otherwise)
+				}
+				continue
+			}
+			next = append(next, op.stepNames()...)
+		}
+		for _, waiter := range joinWaiters[name] {
+			if seq.steps[waiter].Join.Delay <= 0 {
+				next = append(next, waiter)
+			}
+		}
+		for _, nextName := range next {
+			if !instant(nextName) {
+				continue
+			}
+			switch state[nextName] {
+			case unvisited:
+				visit(nextName)
+			case inProgress:
+				// Found a cycle; it's the part of the path from the repeated step
+				for idx := len(path) - 1; idx >= 0; idx-- {
+					if path[idx] == nextName {
+						cycles = append(cycles, append([]string(nil), path[idx:]...))
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = finished
+	}
+	for _, name := range names {
+		if state[name] == unvisited && instant(name) {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// contains checks whether seq is, or runs, target as a sub-sequence, at any
+// depth
+func (seq *Sequence) contains(target *Sequence) bool {
+	visited := make(map[*Sequence]bool)
+	var visit func(s *Sequence) bool
+	visit = func(s *Sequence) bool {
+		if s == target {
+			return true
+		}
+		if visited[s] {
+			return false
+		}
+		visited[s] = true
+		for _, step := range s.steps {
+			if step != nil && step.SubSequence != nil && visit(step.SubSequence) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(seq)
+}
+
+func sameUniverses(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for idx, name := range names {
+		quoted[idx] = "\"" + name + "\""
+	}
+	return strings.Join(quoted, ", ")
+}
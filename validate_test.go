@@ -0,0 +1,134 @@
+package animation
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateGoodSequences(t *testing.T) {
+	sizes := make([]uint, numShaftWindows)
+	if err := createFadePulseSeq(white, time.Second).Validate(sizes); err != nil {
+		t.Fatalf("Fade pulse sequence should be valid: %v", err)
+	}
+	seq, err := ParseSequence([]byte(ownedPortalDef), TowerUniverses(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = seq.Validate(sizes); err != nil {
+		t.Fatalf("Owned portal sequence should be valid: %v", err)
+	}
+	// Zero-delay cycles are fine when the steps take time
+	seq = NewSequence().
+		AddInitialStep("a", &Step{Effect: NewTimedSolid(white, time.Second)}).
+		AddStep("b", &Step{Effect: NewTimedSolid(black, time.Second)}).
+		CreateStepCycle("a", "b")
+	if err = seq.Validate(nil); err != nil {
+		t.Fatalf("Cycle of timed steps should be valid: %v", err)
+	}
+	// Effects which can't be cloned are shared by every run of their step, which
+	// is fine
+	seq = NewSequence().AddInitialStep("shared", &Step{Effect: &frameCounter{until: 1}})
+	if err = seq.Validate(nil); err != nil {
+		t.Fatalf("Step with an effect which can't be cloned should be valid: %v", err)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	shared := &Step{Effect: NewSolid(white)}
+	sharedEffect := &frameCounter{until: 1} // Can't be cloned, so really is shared
+	seq := NewSequence().
+		AddInitialStep("start", &Step{Effect: NewTimedSolid(white, time.Second)}).
+		AddStep("orphan", &Step{Effect: NewSolid(white)}).
+		AddStep("offEdge", &Step{UniverseID: 5, Effect: NewSolid(white)}).
+		AddStep("noEffect", &Step{}).
+		AddStep("shared1", shared).
+		AddStep("shared2", shared).
+		AddStep("effect1", &Step{UniverseID: 0, Effect: sharedEffect}).
+		AddStep("effect2", &Step{UniverseID: 1, Effect: sharedEffect}).
+		AddStep("spin1", &Step{Effect: NewTimedSolid(white, 0)}).
+		AddStep("spin2", &Step{Effect: NewClipTo(NewSolid(white), 0)}).
+		AddStep("joiner", &Step{Effect: NewSolid(white), Join: &Join{Steps: []string{"start", "ghost"}, Mode: JoinCount, Count: 3}})
+	seq.steps["start"].
+		ThenDoImmediately("missing").
+		ThenDoImmediately("offEdge").
+		ThenDoImmediately("noEffect").
+		ThenDoImmediately("shared1").
+		ThenDoImmediately("shared2").
+		ThenDoImmediately("effect1").
+		ThenDoImmediately("effect2").
+		ThenDoImmediately("spin1")
+	seq.CreateStepCycle("spin1", "spin2")
+	seq.AddInitialOperation(Operation{StepName: "nowhere"})
+
+	err := seq.Validate([]uint{10, 10})
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Expected a ValidationError; got %v", err)
+	}
+	expected := []string{
+		`initial operation refers to unknown step "nowhere"`,
+		`step "start": followed by unknown step "missing"`,
+		`step "orphan": can never be reached`,
+		`step "offEdge": targets universe 5, but there are only 2 universes`,
+		`step "noEffect": has no effect`,
+		`step "shared1": the same step is also added as "shared2"`,
+		`step "effect1": shares its effect instance with step "effect2"`,
+		`steps "spin1", "spin2" form a cycle which never yields`,
+		`step "joiner": joins unknown step "ghost"`,
+		`step "joiner": join waits for 3 of 2 steps`,
+		`step "joiner": can never be reached`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Fatalf("Expected problem %q; got %v", e, err)
+		}
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems; got %d: %v", len(expected), len(problems), err)
+	}
+}
+
+func TestValidateNowhereToRun(t *testing.T) {
+	seq := NewSequence().
+		AddGroup("none").
+		AddInitialStep("empty", &Step{Group: "none", Effect: NewSolid(white)}).
+		AddStep("nested", &Step{SubSequence: NewSequence()})
+	seq.CreateStepCycle("empty", "nested")
+
+	err := seq.Validate(nil)
+	if err == nil {
+		t.Fatalf("Expected problems with steps which have nowhere to run")
+	}
+	for _, e := range []string{
+		`step "empty": targets empty group "none"`,
+		`steps "empty", "nested" form a cycle which never yields`,
+	} {
+		if !strings.Contains(err.Error(), e) {
+			t.Fatalf("Expected problem %q; got %v", e, err)
+		}
+	}
+}
+
+func TestDurationOf(t *testing.T) {
+	tests := []struct {
+		effect Animation
+		d      time.Duration
+		known  bool
+	}{
+		{NewTimedSolid(white, time.Second), time.Second, true},
+		{NewSolid(white), Forever, true},
+		{NewLoop(NewTimedSolid(white, time.Second)), Forever, true},
+		{NewRepeat(NewTimedSolid(white, time.Second), 3), 3 * time.Second, true},
+		{NewSpeed(NewTimedSolid(white, time.Second), 2.0), 500 * time.Millisecond, true},
+		{NewDelay(NewTimedSolid(white, time.Second), time.Second), 2 * time.Second, true},
+		{NewClipTo(NewSolid(white), time.Second), time.Second, true},
+		{NewMirror(NewPingPong(NewSolid(white), time.Second), false), 2 * time.Second, true},
+		{NewRainbow(time.Second, 1.0), 0, false},
+	}
+	for idx, test := range tests {
+		if d, known := DurationOf(test.effect); d != test.d || known != test.known {
+			t.Fatalf("Test %d: expected %v, %v; got %v, %v", idx, test.d, test.known, d, known)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package animation
+
+/*
+Views let an effect render into only part of a universe, or have its output
+reflected or repeated across the universe. Like combinators, they wrap an
+existing effect and implement Animation themselves.
+*/
+
+import (
+	"image/color"
+	"time"
+)
+
+// SubRange runs an effect on a contiguous range of pixels within the buffer,
+// leaving the remaining pixels untouched
+type SubRange struct {
+	effect Animation
+	start  int
+	length int
+}
+
+// NewSubRange creates a SubRange view covering length pixels from start. The
+// range is clipped to the size of the buffer being rendered
+func NewSubRange(effect Animation, start, length int) *SubRange {
+	return &SubRange{effect: effect, start: start, length: length}
+}
+
+// Start starts the wrapped effect
+func (v *SubRange) Start(startTime time.Time) {
+	v.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (v *SubRange) Clone() Animation {
+	c := *v
+	c.effect = cloneEffect(v.effect)
+	return &c
+}
+
+// Frame renders the wrapped effect into the range
+func (v *SubRange) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	// Only the part of the range within the buffer is drawn; a range with a
+	// negative length is empty
+	start, end := clampIndex(v.start, len(buf)), clampIndex(v.start+v.length, len(buf))
+	if end < start {
+		end = start
+	}
+	sub := buf[start:end]
+	out, done := v.effect.Frame(sub, frameTime)
+	copy(sub, out)
+	return buf, done
+}
+
+// clampIndex limits idx to a position within a buffer of length n, inclusive
+// of the end
+func clampIndex(idx, n int) int {
+	if idx < 0 {
+		return 0
+	}
+	if idx > n {
+		return n
+	}
+	return idx
+}
+
+// Mirror renders an effect into half of the buffer and reflects it into the
+// other half
+type Mirror struct {
+	effect     Animation
+	fromCenter bool
+	scratch    []color.RGBA
+}
+
+// NewMirror creates a Mirror view. If fromCenter is true the first pixel of the
+// effect is placed at the center of the buffer and the effect expands
+// outwards; otherwise the first pixel is placed at both ends and the effect
+// converges on the center
+func NewMirror(effect Animation, fromCenter bool) *Mirror {
+	return &Mirror{effect: effect, fromCenter: fromCenter}
+}
+
+// Start starts the wrapped effect
+func (v *Mirror) Start(startTime time.Time) {
+	v.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (v *Mirror) Clone() Animation {
+	return &Mirror{effect: cloneEffect(v.effect), fromCenter: v.fromCenter}
+}
+
+// Frame renders half the buffer's worth of the wrapped effect, then reflects it
+func (v *Mirror) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	n := len(buf)
+	half := (n + 1) / 2
+	if len(v.scratch) != half {
+		v.scratch = make([]color.RGBA, half)
+		// Seed from the buffer, for the benefit of effects that start from the
+		// current color
+		for i := range v.scratch {
+			v.scratch[i] = buf[v.mirrorIndex(n, i)]
+		}
+	}
+	out, done := v.effect.Frame(v.scratch, frameTime)
+	copy(v.scratch, out)
+	for i, c := range v.scratch {
+		buf[v.mirrorIndex(n, i)] = c
+		buf[n-1-v.mirrorIndex(n, i)] = c
+	}
+	return buf, done
+}
+
+// mirrorIndex gives one of the two buffer positions for pixel i of the pattern;
+// the other is its reflection
+func (v *Mirror) mirrorIndex(n, i int) int {
+	if v.fromCenter {
+		return n/2 + i
+	}
+	return i
+}
+
+// Tile renders an effect into a small tile, which is then repeated across the
+// buffer
+type Tile struct {
+	effect  Animation
+	scratch []color.RGBA
+}
+
+// NewTile creates a Tile view, with the effect rendering tileSize pixels
+func NewTile(effect Animation, tileSize int) *Tile {
+	return &Tile{effect: effect, scratch: make([]color.RGBA, tileSize)}
+}
+
+// Start starts the wrapped effect
+func (v *Tile) Start(startTime time.Time) {
+	v.effect.Start(startTime)
+}
+
+// Clone creates an unstarted copy, cloning the wrapped effect if possible
+func (v *Tile) Clone() Animation {
+	return &Tile{effect: cloneEffect(v.effect), scratch: make([]color.RGBA, len(v.scratch))}
+}
+
+// Frame renders the tile and repeats it across the buffer
+func (v *Tile) Frame(buf []color.RGBA, frameTime time.Time) (output []color.RGBA, endSeq bool) {
+	if len(v.scratch) == 0 {
+		return buf, false
+	}
+	out, done := v.effect.Frame(v.scratch, frameTime)
+	copy(v.scratch, out)
+	for i := range buf {
+		buf[i] = v.scratch[i%len(v.scratch)]
+	}
+	return buf, done
+}
@@ -0,0 +1,83 @@
+package animation
+
+import (
+	"image/color"
+	"testing"
+	"time"
+)
+
+// reds extracts the red channel of each pixel
+func reds(buf []color.RGBA) []uint8 {
+	r := make([]uint8, len(buf))
+	for idx, c := range buf {
+		r[idx] = c.R
+	}
+	return r
+}
+
+func checkReds(t *testing.T, name string, buf []color.RGBA, expected []uint8) {
+	got := reds(buf)
+	if len(got) != len(expected) {
+		t.Fatalf("%s: length %d, expected %d", name, len(got), len(expected))
+	}
+	for idx := range got {
+		if got[idx] != expected[idx] {
+			t.Fatalf("%s: got %v, expected %v", name, got, expected)
+		}
+	}
+}
+
+func TestSubRange(t *testing.T) {
+	ta := testAnimation(1)
+	v := NewSubRange(&ta, 2, 3)
+	v.Start(time.Unix(0, 0))
+	buf := make([]color.RGBA, 6)
+	out, _ := v.Frame(buf, time.Unix(0, 0))
+	checkReds(t, "subrange", out, []uint8{0, 0, 1, 4, 7, 0})
+
+	// Clipped to buffer
+	v = NewSubRange(&ta, 4, 10)
+	out, _ = v.Frame(make([]color.RGBA, 6), time.Unix(0, 0))
+	checkReds(t, "clipped", out, []uint8{0, 0, 0, 0, 1, 4})
+
+	// Starting before the buffer, or with a negative length
+	v = NewSubRange(&ta, -2, 4)
+	out, _ = v.Frame(make([]color.RGBA, 6), time.Unix(0, 0))
+	checkReds(t, "negative start", out, []uint8{1, 4, 0, 0, 0, 0})
+	v = NewSubRange(&ta, 2, -1)
+	out, _ = v.Frame(make([]color.RGBA, 6), time.Unix(0, 0))
+	checkReds(t, "negative length", out, []uint8{0, 0, 0, 0, 0, 0})
+}
+
+func TestMirror(t *testing.T) {
+	ta := testAnimation(1)
+	v := NewMirror(&ta, false)
+	out, _ := v.Frame(make([]color.RGBA, 5), time.Unix(0, 0))
+	checkReds(t, "from edges", out, []uint8{1, 4, 7, 4, 1})
+
+	v = NewMirror(&ta, true)
+	out, _ = v.Frame(make([]color.RGBA, 6), time.Unix(0, 0))
+	checkReds(t, "from center", out, []uint8{7, 4, 1, 1, 4, 7})
+}
+
+func TestTile(t *testing.T) {
+	ta := testAnimation(1)
+	v := NewTile(&ta, 2)
+	out, _ := v.Frame(make([]color.RGBA, 5), time.Unix(0, 0))
+	checkReds(t, "tile", out, []uint8{1, 4, 1, 4, 1})
+}
+
+func TestViewClone(t *testing.T) {
+	ms := time.Millisecond
+	fade := NewEased(NewInterpolateSolid(black, white, 100*ms), Easings["linear"], 100*ms)
+	effect := NewTile(NewMirror(NewSubRange(fade, 0, 2), false), 4)
+	clone := effect.Clone()
+	now := time.Unix(0, 0)
+	effect.Start(now)
+	clone.Start(now.Add(50 * ms))
+	// Each has its own state, all the way down to the fade
+	out, _ := effect.Frame(make([]color.RGBA, 4), now.Add(50*ms))
+	checkReds(t, "original", out, []uint8{0x80, 0x80, 0x80, 0x80})
+	out, _ = clone.Frame(make([]color.RGBA, 4), now.Add(50*ms))
+	checkReds(t, "clone", out, []uint8{0, 0, 0, 0})
+}